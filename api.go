@@ -0,0 +1,339 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Result kinds
+const (
+	ResultNone = iota
+	ResultValue
+	ResultAssignment
+	ResultDeclaration
+	ResultCommand
+)
+
+// Result of instruction execution (can be one of Result kinds)
+type Result struct {
+	Kind   int
+	Value  float64 // value of expression or assigned variable
+	Number Value   // exact value in numeric mode of interpreter
+	Name   string  // name of assigned variable or declared function
+	Output string  // output of meta command
+
+	Warnings []string // inexact calculations of exact numeric mode
+}
+
+func isIdentifier(s string) bool {
+	identifier, cnt := ParseIdentifier(s)
+	return identifier != "" && cnt == len(s)
+}
+
+// isAssignment checks for assignment (=) or overriding assignment (:=)
+func isAssignment(tokens []*Token) bool {
+	return len(tokens) >= 2 && (tokens[1].Operator == "=" || tokens[1].Operator == ":=")
+}
+
+// Exec executes single instruction
+func (ir *Interpreter) Exec(input string) (*Result, error) {
+	tokens, err := NewStringTokenizer(input).Tokens()
+	if err != nil {
+		// other errors of input are reported too
+		return nil, ir.Check(input).Err()
+	}
+	return ir.exec(input, tokens, false)
+}
+
+// ExecAll executes instructions of input separated by commas (a = 1, b = 2, a + b),
+// it stops at first error and returns results of instructions executed before it
+func (ir *Interpreter) ExecAll(input string) ([]*Result, error) {
+	tokens, err := NewStringTokenizer(input).Tokens()
+	return ir.execAll(input, tokens, err, false)
+}
+
+// execAll executes instructions of tokens, input is their source,
+// err is error of tokenizer (nothing is executed then), results are added to history if record is set
+func (ir *Interpreter) execAll(input string, tokens []*Token, err error, record bool) ([]*Result, error) {
+	if err != nil {
+		return nil, ir.checkTokens(tokens, err).Err()
+	}
+	results := []*Result{}
+	for _, instr := range splitInstructions(tokens) {
+		res, err := ir.exec(input[instr[0].Pos:instr[len(instr)-1].End], instr, record)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// splitInstructions splits tokens by commas outside of parens,
+// meta command is instruction by itself (it takes rest of line)
+func splitInstructions(tokens []*Token) [][]*Token {
+	res := [][]*Token{}
+	start, depth := 0, 0
+	for i, tok := range tokens {
+		switch {
+		case tok.Operator == "(":
+			depth++
+		case tok.Operator == ")":
+			depth--
+		case tok.Type == TokenMetaCommand:
+			res = append(res, tokens[start:i], tokens[i:i+1])
+			start = i + 1
+		case tok.Delimiter == "," && depth <= 0:
+			res = append(res, tokens[start:i])
+			start = i + 1
+		}
+	}
+	res = append(res, tokens[start:])
+
+	// empty instructions are skipped (a = 1, , b = 2)
+	instrs := res[:0]
+	for _, instr := range res {
+		if len(instr) > 0 {
+			instrs = append(instrs, instr)
+		}
+	}
+	return instrs
+}
+
+// exec executes instruction of tokens, input is source of instruction
+// values of interactive instructions are added to history if record is set
+func (ir *Interpreter) exec(input string, tokens []*Token, record bool) (*Result, error) {
+	// warnings of failed instructions are dropped
+	ir.num.warnings()
+	res, err := ir.execTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if res.Kind != ResultCommand {
+		res.Warnings = ir.num.warnings()
+	}
+	if res.Kind == ResultValue || res.Kind == ResultAssignment {
+		ir.last = res.Number
+	}
+	if res.Kind == ResultValue && record {
+		ir.addHistory(input, res.Number)
+	}
+	return res, nil
+}
+
+func (ir *Interpreter) execTokens(tokens []*Token) (*Result, error) {
+	if len(tokens) == 0 {
+		return &Result{Kind: ResultNone}, nil
+	}
+	if tokens[0].Type == TokenMetaCommand {
+		out, err := ir.ProcessMetaCommand(tokens[0])
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Kind: ResultCommand, Output: out}, nil
+	}
+	if isAssignment(tokens) {
+		switch tokens[0].Type {
+		case TokenVariable:
+			if err := ir.processAssignment(tokens); err != nil {
+				return nil, err
+			}
+			name := tokens[0].Variable
+			val := ir.vars[name]
+			return &Result{Kind: ResultAssignment, Name: name, Value: ir.num.float(val), Number: val}, nil
+		case TokenFunction:
+			if err := ir.processFunctionDeclaration(tokens); err != nil {
+				return nil, err
+			}
+			return &Result{Kind: ResultDeclaration, Name: tokens[0].Function}, nil
+		default:
+			return nil, tokenError(tokens[0], "invalid assignment")
+		}
+	}
+	res, err := ir.calculateExpression(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Kind: ResultValue, Value: ir.num.float(res), Number: res}, nil
+}
+
+// Eval calculates value of expression (converted to float64 in other numeric modes)
+func (ir *Interpreter) Eval(expr string) (float64, error) {
+	res, err := ir.EvalValue(expr)
+	if err != nil {
+		return 0, err
+	}
+	return ir.num.float(res), nil
+}
+
+// EvalValue calculates exact value of expression in numeric mode of interpreter
+func (ir *Interpreter) EvalValue(expr string) (Value, error) {
+	tokens, err := NewStringTokenizer(expr).Tokens()
+	if err != nil {
+		return nil, ir.Check(expr).Err()
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("nothing to calculate")
+	}
+	if tokens[0].Type == TokenMetaCommand || isAssignment(tokens) {
+		return nil, errors.New("not an expression")
+	}
+	return ir.calculateExpression(tokens)
+}
+
+// Check returns all errors of instructions that can be found without executing them:
+// bad tokens, syntax errors, unknown variables and functions of expressions
+func (ir *Interpreter) Check(input string) ErrorList {
+	return ir.checkTokens(NewStringTokenizer(input).Tokens())
+}
+
+// checkTokens returns errors of instructions of tokens, err is error of tokenizer
+func (ir *Interpreter) checkTokens(tokens []*Token, err error) ErrorList {
+	errs := ErrorList{}
+	errs.addAll(err)
+	for _, instr := range splitInstructions(tokens) {
+		errs.addAll(ir.checkInstruction(instr).Err())
+	}
+	errs.sort()
+	return errs
+}
+
+// checkInstruction returns errors of one instruction
+func (ir *Interpreter) checkInstruction(tokens []*Token) ErrorList {
+	errs := ErrorList{}
+	var expr []*Token
+	switch {
+	case len(tokens) == 0 || tokens[0].Type == TokenMetaCommand:
+	case isAssignment(tokens) && tokens[0].Type == TokenFunction:
+		_, err := ir.parseFunctionDeclaration(tokens)
+		errs.addAll(err)
+	case isAssignment(tokens):
+		expr = tokens[2:]
+	default:
+		expr = tokens
+	}
+	if len(expr) > 0 {
+		tree, err := ir.parse(expr)
+		errs.addAll(err)
+		if err == nil {
+			errs.addAll(ir.checkTree(tree))
+		}
+	}
+	return errs
+}
+
+// SetVar creates or updates variable
+func (ir *Interpreter) SetVar(name string, value float64) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	if isHistoryName(name) {
+		return fmt.Errorf("%s is history reference", name)
+	}
+	val, err := ir.num.convert(value)
+	if err != nil {
+		return err
+	}
+	ir.vars[name] = val
+	return nil
+}
+
+// GetVar returns value of variable (converted to float64 in other numeric modes)
+func (ir *Interpreter) GetVar(name string) (float64, bool) {
+	val, ok := ir.vars[name]
+	if !ok {
+		return 0, false
+	}
+	return ir.num.float(val), true
+}
+
+// SetValue creates or updates variable with value of any numeric mode
+func (ir *Interpreter) SetValue(name string, value Value) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	if isHistoryName(name) {
+		return fmt.Errorf("%s is history reference", name)
+	}
+	val, err := convertValue(ir.num, value)
+	if err != nil {
+		return err
+	}
+	ir.vars[name] = val
+	return nil
+}
+
+// GetValue returns exact value of variable
+func (ir *Interpreter) GetValue(name string) (Value, bool) {
+	val, ok := ir.vars[name]
+	return val, ok
+}
+
+// DeleteVar deletes variable, reports whether it existed
+func (ir *Interpreter) DeleteVar(name string) bool {
+	_, ok := ir.vars[name]
+	delete(ir.vars, name)
+	return ok
+}
+
+// Vars returns sorted names of variables
+func (ir *Interpreter) Vars() []string {
+	names := make([]string, 0, len(ir.vars))
+	for name := range ir.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefineFunc creates or updates function with params calculating body expression
+func (ir *Interpreter) DefineFunc(name string, params []string, body string) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	tokens := []*Token{Func(name), Op("="), Op("(")}
+	for i, param := range params {
+		if !isIdentifier(param) {
+			return fmt.Errorf("invalid parameter name %q", param)
+		}
+		if i > 0 {
+			tokens = append(tokens, Delim(","))
+		}
+		tokens = append(tokens, Var(param))
+	}
+	tokens = append(tokens, Op(")"), Delim(":"))
+
+	bodyTokens, err := NewStringTokenizer(body).Tokens()
+	if err != nil {
+		return err
+	}
+
+	return ir.processFunctionDeclaration(append(tokens, bodyTokens...))
+}
+
+// GetFunc returns definition of function in form "(a, b): a + b"
+func (ir *Interpreter) GetFunc(name string) (string, bool) {
+	fn, ok := ir.funcs[name]
+	if !ok {
+		return "", false
+	}
+	return fn.String(), true
+}
+
+// DeleteFunc deletes function, reports whether it existed
+func (ir *Interpreter) DeleteFunc(name string) bool {
+	_, ok := ir.funcs[name]
+	delete(ir.funcs, name)
+	return ok
+}
+
+// Funcs returns sorted names of functions
+func (ir *Interpreter) Funcs() []string {
+	names := make([]string, 0, len(ir.funcs))
+	for name := range ir.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,156 @@
+package gocalc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+
+	ass.NoError(ir.SetVar("x", 3))
+	ass.NoError(ir.DefineFunc("sum", []string{"a", "b"}, "a + b"))
+
+	res, err := ir.Eval("@sum(x, 2) * 2")
+	ass.NoError(err)
+	ass.EqualValues(10, res)
+
+	// literals are parsed exactly as float64 literals of go
+	res, err = ir.Eval("0.1 + 0.2")
+	ass.NoError(err)
+	a, b := 0.1, 0.2
+	ass.Equal(a+b, res)
+
+	_, err = ir.Eval("x = 2")
+	ass.Error(err)
+
+	_, err = ir.Eval("2 + (3")
+	var perr *Error
+	if ass.True(errors.As(err, &perr)) {
+		ass.Equal(4, perr.Pos)
+	}
+
+	_, err = ir.Eval("2 + $")
+	if ass.True(errors.As(err, &perr)) {
+		ass.Equal(4, perr.Pos)
+		ass.Equal("bad token", perr.Msg)
+	}
+}
+
+func TestExec(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+	tests := []struct {
+		input string
+		res   Result
+	}{
+		{"", Result{Kind: ResultNone}},
+		{"a = 2 * 3", Result{Kind: ResultAssignment, Name: "a", Value: 6, Number: 6.0}},
+		{"@f = (x): x + 1", Result{Kind: ResultDeclaration, Name: "f"}},
+		{"@f(1)", Result{Kind: ResultValue, Value: 2, Number: 2.0}},
+		{";mem", Result{Kind: ResultCommand, Output: "memory:\na\t= 6\n@f\t= (x): x + 1\n"}},
+	}
+
+	for _, test := range tests {
+		res, err := ir.Exec(test.input)
+		if ass.NoError(err, test.input) {
+			ass.Equal(test.res, *res, test.input)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	ass.NoError(ir.SetVar("x", 1))
+	ass.NoError(ir.DefineFunc("f", []string{"a"}, "a"))
+
+	ass.Empty(ir.Check("@f(x) + pi"))
+	ass.Empty(ir.Check(";mem"))
+	ass.Equal(ErrorList{
+		{Pos: 0, End: 2, Msg: "unknown variable: yy"},
+		{Pos: 5, End: 7, Msg: "call @f: wrong argument count"},
+		{Pos: 16, End: 18, Msg: "unknown function @g"},
+		{Pos: 19, End: 20, Msg: "unknown variable: z"},
+	}, ir.Check("yy + @f(1, 2) * @g(z)"))
+	ass.Equal(ErrorList{
+		{Pos: 4, End: 5, Msg: "bad token"},
+		{Pos: 8, End: 9, Msg: "missing operator before 2"},
+	}, ir.Check("a = $ 1 2"))
+	ass.Equal(ErrorList{
+		{Pos: 11, End: 12, Msg: "missing operator before y"},
+		{Pos: 13, End: 14, Msg: "bad token"},
+	}, ir.Check("@g = (): x y $ 1"))
+
+	// everything is reported by Exec and Eval too
+	_, err := ir.Exec("1 + $ + y")
+	ass.Len(Errors(err), 2)
+	_, err = ir.Eval("y + z")
+	ass.Len(Errors(err), 2)
+	ass.Equal("error: at index 0: unknown variable: y\nerror: at index 4: unknown variable: z",
+		ir.ProcessInstruction("y + z"))
+	ass.Equal("at index 0: unknown variable: y (and 1 more errors)", err.Error())
+}
+
+func TestExecAll(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	results, err := ir.ExecAll("a = 1, @f = (x, y): @max(x, y), @f(a, 2), , ;vars")
+	ass.NoError(err)
+	kinds := []int{}
+	for _, res := range results {
+		kinds = append(kinds, res.Kind)
+	}
+	ass.Equal([]int{ResultAssignment, ResultDeclaration, ResultValue, ResultCommand}, kinds)
+	ass.Equal("variables:\na\t= 1.00", results[3].Output)
+	// only interactive instructions are added to history
+	ass.Empty(ir.History())
+
+	results, err = ir.ExecAll("b = 2, c, b = 3")
+	ass.Len(results, 1)
+	ass.EqualError(err, "at index 7: unknown variable: c")
+	ass.Equal(2.0, ir.vars["b"])
+
+	_, err = ir.ExecAll("b = $, c + 1")
+	ass.Len(Errors(err), 2)
+	_, err = ir.Exec("a, b")
+	ass.EqualError(err, "at index 1: unexpected ,")
+
+	ass.Equal("1.00\n1.00\nerror: at index 10: unknown variable: x", ir.ProcessInstruction("a, b - 1, x # comment"))
+	ass.Equal("", ir.ProcessInstruction("# comment"))
+}
+
+func TestVarsAndFuncs(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+
+	ass.NoError(ir.SetVar("b", 1))
+	ass.NoError(ir.SetVar("a", 2))
+	ass.Error(ir.SetVar("1a", 2))
+	ass.Equal([]string{"a", "b"}, ir.Vars())
+
+	val, ok := ir.GetVar("a")
+	ass.True(ok)
+	ass.EqualValues(2, val)
+
+	ass.True(ir.DeleteVar("a"))
+	ass.False(ir.DeleteVar("a"))
+	_, ok = ir.GetVar("a")
+	ass.False(ok)
+
+	ass.NoError(ir.DefineFunc("neg", []string{"x"}, "-x"))
+	ass.NoError(ir.DefineFunc("one", nil, "1"))
+	ass.Error(ir.DefineFunc("bad", []string{"x y"}, "x"))
+	ass.Equal([]string{"neg", "one"}, ir.Funcs())
+
+	def, ok := ir.GetFunc("neg")
+	ass.True(ok)
+	ass.Equal("(x): -x", def)
+
+	ass.True(ir.DeleteFunc("neg"))
+	ass.False(ir.DeleteFunc("neg"))
+	ass.Equal([]string{"one"}, ir.Funcs())
+}
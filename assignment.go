@@ -1,16 +1,25 @@
 package gocalc
 
-import "errors"
-
 func (ir *Interpreter) processAssignment(tokens []*Token) error {
-	if !(len(tokens) >= 2 && tokens[1].Operator == "=") {
-		return errors.New("invalid assignment")
+	if !isAssignment(tokens) {
+		return tokensError(tokens, "invalid assignment")
 	}
 	if tokens[0].Type != TokenVariable {
-		return errors.New("invalid assignment: no variable on left side")
+		return tokenError(tokens[0], "invalid assignment: no variable on left side")
 	}
 	varname := tokens[0].Variable
+	if isHistoryName(varname) {
+		return tokenError(tokens[0], "%s is history reference", varname)
+	}
+	if _, ok := ir.vars[varname]; !ok && tokens[1].Operator != ":=" {
+		if ir.isConstant(varname) {
+			return tokenError(tokens[0], "%s is constant (use := to override)", varname)
+		}
+	}
 	expr := tokens[2:]
+	if len(expr) == 0 {
+		return newError(tokens[1].End, "expected expression after %s", tokens[1])
+	}
 	varval, err := ir.calculateExpression(expr)
 	if err != nil {
 		return err
@@ -0,0 +1,239 @@
+package gocalc
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Node kinds
+const (
+	NodeNumber = iota
+	NodeVariable
+	NodeUnary
+	NodeBinary
+	NodeCall
+	NodeCond // cond ? then : else
+)
+
+// Node of expression tree (can be one of Node kinds)
+type Node struct {
+	Kind int
+	Tok  *Token  // number, variable, operator or function token
+	Args []*Node // operands of operator, arguments of call or condition and branches
+	Pos  int     // position of node in input
+	End  int     // position after node in input
+}
+
+// leafNode creates number or variable node
+func leafNode(tok *Token) *Node {
+	kind := NodeNumber
+	if tok.Type == TokenVariable {
+		kind = NodeVariable
+	}
+	return &Node{Kind: kind, Tok: tok, Pos: tok.Pos, End: tok.End}
+}
+
+// condNode creates conditional node with ? token
+func condNode(tok *Token, cond, then, els *Node) *Node {
+	return &Node{Kind: NodeCond, Tok: tok, Args: []*Node{cond, then, els},
+		Pos: minInt(cond.Pos, tok.Pos), End: maxInt(els.End, tok.End)}
+}
+
+// opNode creates unary or binary operator node
+func opNode(tok *Token, args ...*Node) *Node {
+	kind := NodeBinary
+	if len(args) == 1 {
+		kind = NodeUnary
+	}
+	n := &Node{Kind: kind, Tok: tok, Args: args, Pos: tok.Pos, End: tok.End}
+	for _, arg := range args {
+		n.Pos = minInt(n.Pos, arg.Pos)
+		n.End = maxInt(n.End, arg.End)
+	}
+	return n
+}
+
+// withArgs returns copy of node with other operands
+func (n *Node) withArgs(args []*Node) *Node {
+	return &Node{Kind: n.Kind, Tok: n.Tok, Args: args, Pos: n.Pos, End: n.End}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Postfix returns tree in postfix notation
+func (n *Node) Postfix() []*Token {
+	return n.postfix(nil)
+}
+
+// isShortCircuit reports if node is && or || (right operand is calculated only if it's needed)
+func (n *Node) isShortCircuit() bool {
+	return n.Kind == NodeBinary && (n.Tok.Operator == "&&" || n.Tok.Operator == "||")
+}
+
+// eagerArgs returns operands that are always calculated (not branches)
+func (n *Node) eagerArgs() []*Node {
+	if n.Kind == NodeCond || n.isShortCircuit() {
+		return n.Args[:1]
+	}
+	return n.Args
+}
+
+// jump returns copy of token of node as operator op that skips count tokens
+func (n *Node) jump(op string, count int) *Token {
+	tok := *n.Tok
+	tok.Type, tok.Operator, tok.Jump = TokenOperator, op, count
+	return &tok
+}
+
+// postfix appends postfix notation of tree to out
+// branches of conditional and right operand of && and || are skipped with jumps:
+// cond ?(skip then) then :(skip else) else, a &&(skip b) b bool
+func (n *Node) postfix(out []*Token) []*Token {
+	switch {
+	case n.Kind == NodeCond:
+		out = n.Args[0].postfix(out)
+		then, els := n.Args[1].Postfix(), n.Args[2].Postfix()
+		out = append(out, n.jump("?", len(then)+1))
+		out = append(append(out, then...), n.jump(":", len(els)))
+		return append(out, els...)
+	case n.isShortCircuit():
+		out = n.Args[0].postfix(out)
+		right := n.Args[1].Postfix()
+		out = append(out, n.jump(n.Tok.Operator, len(right)+1))
+		return append(append(out, right...), n.jump("ubool", 0))
+	}
+	for _, arg := range n.Args {
+		out = arg.postfix(out)
+	}
+	switch {
+	case n.Kind == NodeBinary && conversionOps[n.Tok.Operator]:
+		// unit is named by source of right operand
+		tok := *n.Tok
+		tok.Literal = unitText(n.Args[1])
+		return append(out, &tok)
+	case n.Tok.Operator == "mul":
+		tok := *n.Tok
+		tok.Operator = "*"
+		return append(out, &tok)
+	}
+	return append(out, n.Tok)
+}
+
+// priority of node when it is operand of operator
+func (n *Node) priority() int {
+	switch {
+	case n.Kind == NodeNumber && n.Tok.Number < 0:
+		// printed with sign, so it's like unary operator
+		return opPriority["u-"]
+	case n.Kind == NodeUnary || n.Kind == NodeBinary:
+		return opPriority[n.Tok.Operator]
+	case n.Kind == NodeCond:
+		return minPriority - 1
+	}
+	return math.MaxInt32
+}
+
+func (n *Node) isUnaryLike() bool {
+	return n.priority() == opPriority["u-"]
+}
+
+// Infix returns tree in infix notation, parens are added only where needed
+func (n *Node) Infix() []*Token {
+	return n.infix(nil)
+}
+
+// infix appends infix notation of tree to out
+func (n *Node) infix(out []*Token) []*Token {
+	switch n.Kind {
+	case NodeCall:
+		out = append(out, n.Tok, Op("("))
+		for i, arg := range n.Args {
+			if i > 0 {
+				out = append(out, Delim(","))
+			}
+			out = arg.infix(out)
+		}
+		return append(out, Op(")"))
+	case NodeUnary:
+		arg := n.Args[0]
+		out = append(out, n.Tok)
+		return arg.infixOperand(out, arg.priority() < n.priority())
+	case NodeBinary:
+		left, right := n.Args[0], n.Args[1]
+		p := n.priority()
+		out = left.infixOperand(out, left.priority() < p ||
+			left.priority() == p && rightAssoc[n.Tok.Operator])
+		out = append(out, n.Tok)
+		// unary operator is allowed right after binary operator
+		return right.infixOperand(out, !right.isUnaryLike() && (right.priority() < p ||
+			right.priority() == p && !rightAssoc[n.Tok.Operator]))
+	case NodeCond:
+		// conditional is right associative, nested one is clearer in parens in other places
+		cond, then, els := n.Args[0], n.Args[1], n.Args[2]
+		out = cond.infixOperand(out, cond.Kind == NodeCond)
+		out = append(out, n.Tok)
+		out = then.infixOperand(out, then.Kind == NodeCond)
+		out = append(out, Delim(":"))
+		return els.infix(out)
+	}
+	return append(out, n.Tok)
+}
+
+func (n *Node) infixOperand(out []*Token, parens bool) []*Token {
+	if !parens {
+		return n.infix(out)
+	}
+	out = append(out, Op("("))
+	out = n.infix(out)
+	return append(out, Op(")"))
+}
+
+func (n *Node) String() string {
+	return buildExprFromTokens(n.Infix())
+}
+
+// key returns text of tree, equal trees have equal keys
+func (n *Node) key() string {
+	buf := &strings.Builder{}
+	for _, tok := range n.Postfix() {
+		switch tok.Type {
+		case TokenOperator:
+			buf.WriteString(tok.Operator)
+		case TokenFunction:
+			fmt.Fprintf(buf, "%s#%d", tok, tok.Argc)
+		default:
+			buf.WriteString(tok.String())
+		}
+		buf.WriteByte(' ')
+	}
+	return buf.String()
+}
+
+func (n *Node) size() int {
+	res := 1
+	for _, arg := range n.Args {
+		res += arg.size()
+	}
+	return res
+}
+
+// Walk calls fn for node and all its descendants (parents first)
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, arg := range n.Args {
+		arg.Walk(fn)
+	}
+}
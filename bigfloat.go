@@ -0,0 +1,714 @@
+package gocalc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// guardBits is extra precision of intermediate results in big mode
+const guardBits = 64
+
+// maxBigExp limits binary exponent of results in big mode, formatting of bigger numbers takes too long
+const maxBigExp = 1 << 16
+
+// bigNumeric is arithmetic of big mode, values are *big.Float with precision prec
+type bigNumeric struct {
+	prec      uint
+	constants map[string]*big.Float // calculated on first use
+	style     int                   // format of output
+}
+
+func newBigNumeric(prec uint) *bigNumeric {
+	return &bigNumeric{prec: prec, constants: map[string]*big.Float{}}
+}
+
+// newBig creates big.Float with precision prec and value x
+func newBig(prec uint, x float64) *big.Float {
+	return new(big.Float).SetPrec(prec).SetFloat64(x)
+}
+
+// round rounds x to precision of mode
+func (m *bigNumeric) round(x *big.Float) *big.Float {
+	return new(big.Float).SetPrec(m.prec).Set(x)
+}
+
+func (m *bigNumeric) mode() (string, uint) {
+	return ModeBig, m.prec
+}
+
+func (m *bigNumeric) number(tok *Token) (Value, error) {
+	if tok.Imag {
+		return nil, errImag
+	}
+	if tok.Literal == "" {
+		return m.convert(tok.Number)
+	}
+	x, _, err := new(big.Float).SetPrec(m.prec).Parse(tok.Literal, 0)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %s", tok.Literal)
+	}
+	return checkSize(x)
+}
+
+// checkSize returns errTooBig if x is too big to be formatted, too small x underflows to zero
+func checkSize(x *big.Float) (*big.Float, error) {
+	if x.IsInf() {
+		return x, nil
+	}
+	switch exp := x.MantExp(nil); {
+	case exp > maxBigExp:
+		return nil, errTooBig
+	case exp < -maxBigExp:
+		z := new(big.Float).SetPrec(x.Prec())
+		if x.Signbit() {
+			z.Neg(z)
+		}
+		return z, nil
+	}
+	return x, nil
+}
+
+func (m *bigNumeric) convert(v Value) (Value, error) {
+	switch v := v.(type) {
+	case *big.Float:
+		return m.round(v), nil
+	case *big.Rat:
+		return new(big.Float).SetPrec(m.prec).SetRat(v), nil
+	case int64, uint64, *big.Int:
+		return new(big.Float).SetPrec(m.prec).SetInt(toBigInt(v)), nil
+	case complex128:
+		if imag(v) != 0 {
+			return nil, errNotReal
+		}
+		return m.convert(real(v))
+	case float64:
+		if math.IsNaN(v) {
+			return nil, errNaN
+		}
+		return newBig(m.prec, v), nil
+	}
+	return nil, fmt.Errorf("can't convert %v", v)
+}
+
+func (m *bigNumeric) float(v Value) float64 {
+	return toFloat64(v)
+}
+
+func (m *bigNumeric) truth(v Value) bool {
+	return v.(*big.Float).Sign() != 0
+}
+
+func (m *bigNumeric) constant(name string) (Value, bool) {
+	if c, ok := m.constants[name]; ok {
+		return c, true
+	}
+	prec := m.prec + guardBits
+	var c *big.Float
+	switch name {
+	case "pi":
+		c = bigPi(prec)
+	case "e":
+		c = bigExp(newBig(prec, 1), prec)
+	case "phi":
+		c = newBig(prec, 5)
+		c.Sqrt(c).Add(c, newBig(prec, 1)).Quo(c, newBig(prec, 2))
+	default:
+		val, ok := constants[name]
+		if !ok {
+			return nil, false
+		}
+		c = newBig(prec, val)
+	}
+	c = m.round(c)
+	m.constants[name] = c
+	return c, true
+}
+
+// catchNaN turns panic of big.Float operation without result into errNaN
+func catchNaN(err *error) {
+	if r := recover(); r != nil {
+		if _, ok := r.(big.ErrNaN); !ok {
+			panic(r)
+		}
+		*err = errNaN
+	}
+}
+
+func (m *bigNumeric) unary(op string, a Value) (Value, error) {
+	switch op {
+	case "u+":
+		return a, nil
+	case "u-":
+		return new(big.Float).SetPrec(m.prec).Neg(a.(*big.Float)), nil
+	}
+	return nil, opError(op)
+}
+
+func (m *bigNumeric) binary(op string, a, b Value) (res Value, err error) {
+	defer catchNaN(&err)
+	x, y := a.(*big.Float), b.(*big.Float)
+	z := new(big.Float).SetPrec(m.prec)
+	switch op {
+	case "+":
+		return z.Add(x, y), nil
+	case "-":
+		return z.Sub(x, y), nil
+	case "*":
+		return checkSize(z.Mul(x, y))
+	case "/":
+		return checkSize(z.Quo(x, y))
+	case "//":
+		return bigFloor(z.Quo(x, y)), nil
+	case "%":
+		return m.mod(x, y)
+	case "^", "**":
+		return m.pow(x, y)
+	}
+	if compareOps[op] {
+		return z.SetFloat64(boolFloat(compare(op, x.Cmp(y)))), nil
+	}
+	return nil, opError(op)
+}
+
+// mod is remainder of floored division (sign of result is sign of y) like mod of float mode
+func (m *bigNumeric) mod(x, y *big.Float) (*big.Float, error) {
+	switch {
+	case x.IsInf() || y.Sign() == 0:
+		return nil, errNaN
+	case y.IsInf():
+		if x.Sign() == 0 || x.Sign() == y.Sign() {
+			return m.round(x), nil
+		}
+		return m.round(y), nil
+	}
+	// quotient is calculated exactly enough to get its integer part
+	prec := m.prec + guardBits
+	if exp := x.MantExp(nil) - y.MantExp(nil); exp > 0 {
+		prec += uint(exp)
+	}
+	q := bigFloor(new(big.Float).SetPrec(prec).Quo(x, y))
+	q.Mul(q, y)
+	return new(big.Float).SetPrec(m.prec).Sub(x, q), nil
+}
+
+// pow calculates x^y, integer powers are calculated by multiplication
+func (m *bigNumeric) pow(x, y *big.Float) (*big.Float, error) {
+	if y.IsInt() && !y.IsInf() {
+		if n, acc := y.Int64(); acc == big.Exact {
+			// exponent of result is estimated before it is calculated
+			if exp := x.MantExp(nil); (exp > 1 && n > maxBigExp) || (exp < 0 && n < -maxBigExp) {
+				return nil, errTooBig
+			}
+			return checkSize(m.round(bigPowInt(x, n, m.prec+guardBits)))
+		}
+	}
+	switch {
+	case x.IsInf() || y.IsInf():
+		f, _ := x.Float64()
+		g, _ := y.Float64()
+		return m.convertFloat(math.Pow(f, g))
+	case x.Sign() < 0:
+		return nil, errNaN
+	case x.Sign() == 0:
+		if y.Sign() < 0 {
+			return new(big.Float).SetPrec(m.prec).SetInf(false), nil
+		}
+		return newBig(m.prec, 0), nil
+	}
+	prec := m.prec + guardBits
+	if exp := y.MantExp(nil); exp > 0 {
+		prec += uint(exp)
+	}
+	ln, err := bigLn(x, prec)
+	if err != nil {
+		return nil, err
+	}
+	return checkSize(m.round(bigExp(ln.Mul(ln, y), prec)))
+}
+
+// convertFloat converts result of float function
+func (m *bigNumeric) convertFloat(f float64) (*big.Float, error) {
+	if math.IsNaN(f) {
+		return nil, errNaN
+	}
+	return newBig(m.prec, f), nil
+}
+
+func (m *bigNumeric) call(name string, args []Value) (res Value, err error) {
+	defer catchNaN(&err)
+	xs := make([]*big.Float, len(args))
+	for i, arg := range args {
+		xs[i] = arg.(*big.Float)
+	}
+	x := xs[0]
+	prec := m.prec + guardBits
+	var z *big.Float
+	switch name {
+	case "sqrt":
+		if x.Sign() < 0 {
+			return nil, errNaN
+		}
+		return new(big.Float).SetPrec(m.prec).Sqrt(x), nil
+	case "abs":
+		return new(big.Float).SetPrec(m.prec).Abs(x), nil
+	case "re", "conj":
+		return x, nil
+	case "im":
+		return newBig(m.prec, 0), nil
+	case "floor":
+		return m.round(bigFloor(x)), nil
+	case "ceil":
+		z = bigFloor(new(big.Float).Neg(x))
+		return m.round(z.Neg(z)), nil
+	case "trunc":
+		return m.round(bigTrunc(x)), nil
+	case "round":
+		// half away from zero
+		abs := new(big.Float).Abs(x)
+		z = bigFloor(abs).SetPrec(x.Prec() + 1)
+		if abs.Sub(abs, z).Cmp(big.NewFloat(0.5)) >= 0 {
+			z.Add(z, newBig(1, 1))
+		}
+		if x.Signbit() {
+			z.Neg(z)
+		}
+		return m.round(z), nil
+	case "sign":
+		if x.Sign() == 0 {
+			return x, nil
+		}
+		return newBig(m.prec, float64(x.Sign())), nil
+	case "min", "max":
+		res := x
+		for _, y := range xs[1:] {
+			if cmp := y.Cmp(res); (name == "min" && cmp < 0) || (name == "max" && cmp > 0) {
+				res = y
+			}
+		}
+		return res, nil
+	case "hypot":
+		if x.IsInf() || xs[1].IsInf() {
+			return new(big.Float).SetPrec(m.prec).SetInf(false), nil
+		}
+		z = new(big.Float).SetPrec(prec).Mul(x, x)
+		z.Add(z, new(big.Float).SetPrec(prec).Mul(xs[1], xs[1]))
+		return m.round(z.Sqrt(z)), nil
+	case "exp":
+		return checkSize(m.round(bigExp(x, prec)))
+	case "ln", "log10", "log":
+		z, err = bigLn(x, prec)
+		if err != nil || name == "ln" {
+			break
+		}
+		base := newBig(prec, 10)
+		if name == "log" {
+			base = xs[1]
+		}
+		var lnBase *big.Float
+		if lnBase, err = bigLn(base, prec); err == nil {
+			z.Quo(z, lnBase)
+		}
+	case "sin":
+		z, err = bigSin(x, prec)
+	case "cos":
+		z, err = bigCos(x, prec)
+	case "tan":
+		var cos *big.Float
+		if z, err = bigSin(x, prec); err == nil {
+			if cos, err = bigCos(x, prec); err == nil {
+				z.Quo(z, cos)
+			}
+		}
+	case "atan":
+		z = bigAtan(x, prec)
+	case "asin", "acos":
+		z, err = bigAsin(x, prec)
+		if err == nil && name == "acos" {
+			half := bigPi(prec)
+			half.Quo(half, newBig(prec, 2))
+			z.Sub(half, z)
+		}
+	case "atan2":
+		z = bigAtan2(x, xs[1], prec)
+	case "sinh", "cosh", "tanh":
+		z = bigHyperbolic(name, x, prec)
+	default:
+		// builtins without big implementation are calculated with float64
+		floats := make([]float64, len(xs))
+		for i, x := range xs {
+			floats[i], _ = x.Float64()
+		}
+		return m.convertFloat(builtins[name].fn(floats))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return checkSize(m.round(z))
+}
+
+func (m *bigNumeric) format(v Value, precision int) string {
+	return formatBig(v.(*big.Float), m.style, precision)
+}
+
+func (m *bigNumeric) warnings() []string {
+	return nil
+}
+
+func (m *bigNumeric) literal(v Value) string {
+	x := v.(*big.Float)
+	if x.IsInf() {
+		if x.Signbit() {
+			return "-1 / 0"
+		}
+		return "1 / 0"
+	}
+	return x.Text('g', -1)
+}
+
+// bigFloor returns greatest integer value less than or equal to x
+func bigFloor(x *big.Float) *big.Float {
+	if x.IsInf() || x.IsInt() {
+		return new(big.Float).Copy(x)
+	}
+	i, _ := x.Int(nil)
+	if x.Sign() < 0 {
+		i.Sub(i, big.NewInt(1))
+	}
+	return new(big.Float).SetPrec(x.Prec()).SetInt(i)
+}
+
+// bigTrunc returns integer part of x
+func bigTrunc(x *big.Float) *big.Float {
+	if x.IsInf() || x.IsInt() {
+		return new(big.Float).Copy(x)
+	}
+	i, _ := x.Int(nil)
+	z := new(big.Float).SetPrec(x.Prec()).SetInt(i)
+	if x.Signbit() && i.Sign() == 0 {
+		z.Neg(z)
+	}
+	return z
+}
+
+// bigPowInt calculates x^n by squaring with precision prec
+func bigPowInt(x *big.Float, n int64, prec uint) *big.Float {
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	res := newBig(prec, 1)
+	sq := new(big.Float).SetPrec(prec).Set(x)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			res.Mul(res, sq)
+		}
+		if n > 1 {
+			sq.Mul(sq, sq)
+		}
+	}
+	if neg {
+		res.Quo(newBig(prec, 1), res)
+	}
+	return res
+}
+
+// negligible reports if term does not change sum with precision prec
+func negligible(term, sum *big.Float, prec uint) bool {
+	return term.Sign() == 0 || (sum.Sign() != 0 && term.MantExp(nil) < sum.MantExp(nil)-int(prec)-1)
+}
+
+// bigPi calculates pi with Machin's formula pi = 16 atan(1/5) - 4 atan(1/239)
+func bigPi(prec uint) *big.Float {
+	a := bigAtanInv(5, prec+8)
+	b := bigAtanInv(239, prec+8)
+	a.Mul(a, newBig(prec+8, 16))
+	b.Mul(b, newBig(prec+8, 4))
+	return new(big.Float).SetPrec(prec).Sub(a, b)
+}
+
+// bigAtanInv calculates atan(1/n) with its series
+func bigAtanInv(n int64, prec uint) *big.Float {
+	nn := newBig(prec, float64(n*n))
+	term := new(big.Float).SetPrec(prec).Quo(newBig(prec, 1), newBig(prec, float64(n)))
+	sum := new(big.Float).SetPrec(prec).Set(term)
+	t := new(big.Float).SetPrec(prec)
+	for k := int64(1); ; k++ {
+		term.Quo(term, nn)
+		t.Quo(term, newBig(prec, float64(2*k+1)))
+		if negligible(t, sum, prec) {
+			return sum
+		}
+		if k%2 == 1 {
+			sum.Sub(sum, t)
+		} else {
+			sum.Add(sum, t)
+		}
+	}
+}
+
+// bigExp calculates e^x: argument is halved to converge fast, then result is squared back
+func bigExp(x *big.Float, prec uint) *big.Float {
+	switch {
+	case x.IsInf() && x.Sign() > 0:
+		return new(big.Float).SetPrec(prec).SetInf(false)
+	case x.IsInf() || (x.Sign() < 0 && x.MantExp(nil) > 32):
+		return newBig(prec, 0)
+	case x.Sign() == 0:
+		return newBig(prec, 1)
+	case x.MantExp(nil) > 32:
+		// exponent of result is out of range
+		return new(big.Float).SetPrec(prec).SetInf(false)
+	}
+	halvings := 0
+	if exp := x.MantExp(nil); exp > -8 {
+		halvings = exp + 8
+	}
+	// every squaring loses bit of precision
+	wp := prec + uint(halvings) + 8
+	r := new(big.Float).SetPrec(wp).SetMantExp(x, -halvings)
+
+	sum := newBig(wp, 1)
+	term := newBig(wp, 1)
+	for i := 1; ; i++ {
+		term.Mul(term, r)
+		term.Quo(term, newBig(wp, float64(i)))
+		if negligible(term, sum, wp) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < halvings; i++ {
+		sum.Mul(sum, sum)
+	}
+	return new(big.Float).SetPrec(prec).Set(sum)
+}
+
+// bigAtanh calculates atanh(y) with its series for small y
+func bigAtanh(y *big.Float, prec uint) *big.Float {
+	sum := new(big.Float).SetPrec(prec).Set(y)
+	if y.Sign() == 0 {
+		return sum
+	}
+	yy := new(big.Float).SetPrec(prec).Mul(y, y)
+	pow := new(big.Float).SetPrec(prec).Set(y)
+	term := new(big.Float).SetPrec(prec)
+	for k := 1; ; k++ {
+		pow.Mul(pow, yy)
+		term.Quo(pow, newBig(prec, float64(2*k+1)))
+		if negligible(term, sum, prec) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// bigLn calculates natural logarithm: x = mant * 2^exp, ln(mant) = 2 atanh((mant-1)/(mant+1))
+func bigLn(x *big.Float, prec uint) (*big.Float, error) {
+	switch {
+	case x.Sign() < 0:
+		return nil, errNaN
+	case x.Sign() == 0:
+		return new(big.Float).SetPrec(prec).SetInf(true), nil
+	case x.IsInf():
+		return new(big.Float).SetPrec(prec).SetInf(false), nil
+	}
+	wp := prec + 8
+	mant := new(big.Float).SetPrec(wp)
+	exp := x.MantExp(mant)
+	// mant in [sqrt(1/2), sqrt(2)) to avoid cancellation for x near 1
+	if mant.Cmp(big.NewFloat(math.Sqrt2/2)) < 0 {
+		mant.SetMantExp(mant, 1)
+		exp--
+	}
+	one := newBig(wp, 1)
+	y := new(big.Float).SetPrec(wp).Sub(mant, one)
+	y.Quo(y, new(big.Float).SetPrec(wp).Add(mant, one))
+	res := bigAtanh(y, wp)
+	res.SetMantExp(res, 1)
+	if exp != 0 {
+		// ln 2 = 2 atanh(1/3)
+		ln2 := bigAtanh(new(big.Float).SetPrec(wp).Quo(one, newBig(wp, 3)), wp)
+		ln2.SetMantExp(ln2, 1)
+		res.Add(res, ln2.Mul(ln2, newBig(wp, float64(exp))))
+	}
+	return new(big.Float).SetPrec(prec).Set(res), nil
+}
+
+// reduceAngle returns x - 2 pi n in [-pi, pi]
+func reduceAngle(x *big.Float, prec uint) (*big.Float, error) {
+	if x.IsInf() {
+		return nil, errNaN
+	}
+	// integer part of x / 2pi is lost without extra precision
+	wp := prec + 8
+	if exp := x.MantExp(nil); exp > 0 {
+		wp += uint(exp)
+	}
+	twoPi := bigPi(wp)
+	twoPi.SetMantExp(twoPi, 1)
+	n := new(big.Float).SetPrec(wp).Quo(x, twoPi)
+	n.Add(n, big.NewFloat(0.5))
+	n = bigFloor(n)
+	r := new(big.Float).SetPrec(wp).Mul(n, twoPi)
+	return r.Sub(x, r).SetPrec(prec + 8), nil
+}
+
+// bigSinSeries calculates sin (odd series) or cos of r with Taylor series
+func bigSinSeries(r *big.Float, odd bool, prec uint) *big.Float {
+	term := newBig(prec, 1)
+	k := 0
+	if odd {
+		term.Set(r)
+		k = 1
+	}
+	sum := new(big.Float).SetPrec(prec).Set(term)
+	rr := new(big.Float).SetPrec(prec).Mul(r, r)
+	for ; ; k += 2 {
+		term.Mul(term, rr)
+		term.Quo(term, newBig(prec, float64((k+1)*(k+2))))
+		term.Neg(term)
+		if negligible(term, sum, prec) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+func bigSin(x *big.Float, prec uint) (*big.Float, error) {
+	r, err := reduceAngle(x, prec)
+	if err != nil {
+		return nil, err
+	}
+	return bigSinSeries(r, true, prec+8), nil
+}
+
+func bigCos(x *big.Float, prec uint) (*big.Float, error) {
+	r, err := reduceAngle(x, prec)
+	if err != nil {
+		return nil, err
+	}
+	return bigSinSeries(r, false, prec+8), nil
+}
+
+// bigAtan calculates atan: argument is reduced to |x| <= 1 and halved before series
+func bigAtan(x *big.Float, prec uint) *big.Float {
+	wp := prec + 16
+	if x.IsInf() || new(big.Float).Abs(x).Cmp(big.NewFloat(1)) > 0 {
+		// atan(x) = sign(x) pi/2 - atan(1/x)
+		z := bigPi(wp)
+		z.SetMantExp(z, -1)
+		if x.Signbit() {
+			z.Neg(z)
+		}
+		if !x.IsInf() {
+			z.Sub(z, bigAtan(new(big.Float).SetPrec(wp).Quo(newBig(wp, 1), x), wp))
+		}
+		return z.SetPrec(prec)
+	}
+	// atan(x) = 2 atan(x / (1 + sqrt(1 + x^2)))
+	const halvings = 8
+	r := new(big.Float).SetPrec(wp).Set(x)
+	one := newBig(wp, 1)
+	t := new(big.Float).SetPrec(wp)
+	for i := 0; i < halvings; i++ {
+		t.Mul(r, r)
+		t.Add(t, one)
+		t.Sqrt(t)
+		t.Add(t, one)
+		r.Quo(r, t)
+	}
+	sum := new(big.Float).SetPrec(wp).Set(r)
+	pow := new(big.Float).SetPrec(wp).Set(r)
+	rr := new(big.Float).SetPrec(wp).Mul(r, r)
+	for k := 1; ; k++ {
+		pow.Mul(pow, rr)
+		pow.Neg(pow)
+		t.Quo(pow, newBig(wp, float64(2*k+1)))
+		if negligible(t, sum, wp) {
+			break
+		}
+		sum.Add(sum, t)
+	}
+	return sum.SetMantExp(sum, halvings).SetPrec(prec)
+}
+
+// bigAsin calculates asin(x) = atan(x / sqrt(1 - x^2))
+func bigAsin(x *big.Float, prec uint) (*big.Float, error) {
+	wp := prec + 16
+	t := new(big.Float).SetPrec(wp).Mul(x, x)
+	t.Sub(newBig(wp, 1), t)
+	switch t.Sign() {
+	case -1:
+		return nil, errNaN
+	case 0:
+		z := bigPi(prec)
+		z.SetMantExp(z, -1)
+		if x.Signbit() {
+			z.Neg(z)
+		}
+		return z, nil
+	}
+	t.Sqrt(t)
+	return bigAtan(t.Quo(x, t), prec), nil
+}
+
+// bigAtan2 calculates angle of point (x, y) like math.Atan2
+func bigAtan2(y, x *big.Float, prec uint) *big.Float {
+	if x.IsInf() || y.IsInf() {
+		fy, _ := y.Float64()
+		fx, _ := x.Float64()
+		return newBig(prec, math.Atan2(fy, fx))
+	}
+	wp := prec + 8
+	switch {
+	case x.Sign() == 0 && y.Sign() == 0:
+		f, _ := y.Float64()
+		g, _ := x.Float64()
+		return newBig(prec, math.Atan2(f, g))
+	case x.Sign() == 0:
+		z := bigPi(wp)
+		z.SetMantExp(z, -1)
+		if y.Sign() < 0 {
+			z.Neg(z)
+		}
+		return z
+	}
+	z := bigAtan(new(big.Float).SetPrec(wp).Quo(y, x), wp)
+	if x.Sign() < 0 {
+		if y.Signbit() {
+			z.Sub(z, bigPi(wp))
+		} else {
+			z.Add(z, bigPi(wp))
+		}
+	}
+	return z
+}
+
+// bigHyperbolic calculates sinh, cosh or tanh with exp
+func bigHyperbolic(name string, x *big.Float, prec uint) *big.Float {
+	if x.Sign() == 0 && name != "cosh" {
+		return new(big.Float).Copy(x)
+	}
+	if name == "tanh" && x.MantExp(nil) > 20 {
+		return newBig(prec, float64(x.Sign()))
+	}
+	// e^x - e^-x loses bits for small x
+	wp := prec + 8
+	if exp := x.MantExp(nil); exp < 0 {
+		wp += uint(-exp)
+	}
+	t := bigExp(x, wp)
+	inv := new(big.Float).SetPrec(wp).Quo(newBig(wp, 1), t)
+	z := new(big.Float).SetPrec(wp)
+	switch name {
+	case "sinh":
+		z.Sub(t, inv)
+	case "cosh":
+		z.Add(t, inv)
+	case "tanh":
+		z.Sub(t, inv)
+		return z.Quo(z, inv.Add(t, inv))
+	}
+	return z.SetMantExp(z, -1)
+}
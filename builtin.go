@@ -0,0 +1,136 @@
+package gocalc
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// variadic marks builtin without upper limit of arguments
+const variadic = -1
+
+type builtin struct {
+	minArgs int
+	maxArgs int // variadic if not limited
+	fn      func(args []float64) float64
+}
+
+func unary(fn func(float64) float64) *builtin {
+	return &builtin{1, 1, func(args []float64) float64 {
+		return fn(args[0])
+	}}
+}
+
+func binary(fn func(float64, float64) float64) *builtin {
+	return &builtin{2, 2, func(args []float64) float64 {
+		return fn(args[0], args[1])
+	}}
+}
+
+// builtins are functions available in every interpreter
+var builtins = map[string]*builtin{
+	"sqrt":  unary(math.Sqrt),
+	"abs":   unary(math.Abs),
+	"exp":   unary(math.Exp),
+	"ln":    unary(math.Log),
+	"log10": unary(math.Log10),
+	"log": binary(func(x, base float64) float64 {
+		return math.Log(x) / math.Log(base)
+	}),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"asin":  unary(math.Asin),
+	"acos":  unary(math.Acos),
+	"atan":  unary(math.Atan),
+	"sinh":  unary(math.Sinh),
+	"cosh":  unary(math.Cosh),
+	"tanh":  unary(math.Tanh),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"trunc": unary(math.Trunc),
+	"min": {1, variadic, func(args []float64) float64 {
+		res := args[0]
+		for _, arg := range args[1:] {
+			res = math.Min(res, arg)
+		}
+		return res
+	}},
+	"max": {1, variadic, func(args []float64) float64 {
+		res := args[0]
+		for _, arg := range args[1:] {
+			res = math.Max(res, arg)
+		}
+		return res
+	}},
+	"hypot": binary(math.Hypot),
+	"atan2": binary(math.Atan2),
+	// complex functions for real numbers (see complexBuiltins)
+	"re":   unary(func(x float64) float64 { return x }),
+	"im":   unary(func(x float64) float64 { return 0 }),
+	"conj": unary(func(x float64) float64 { return x }),
+	"arg": unary(func(x float64) float64 {
+		return math.Atan2(0, x)
+	}),
+	// polar makes number from magnitude and angle, it is real only for angle 0
+	"polar": binary(func(r, theta float64) float64 {
+		if theta != 0 {
+			return math.NaN()
+		}
+		return r
+	}),
+	"sign": unary(func(x float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return x
+	}),
+}
+
+// constants are variables available in every interpreter
+var constants = map[string]float64{
+	"pi":  math.Pi,
+	"e":   math.E,
+	"phi": math.Phi,
+}
+
+// constantAliases are symbols of constants
+var constantAliases = map[string]string{
+	"π": "pi",
+	"φ": "phi",
+}
+
+// checkArgc checks argument count of call
+func (b *builtin) checkArgc(argc int) error {
+	if argc < b.minArgs || (b.maxArgs != variadic && argc > b.maxArgs) {
+		return errors.New("wrong argument count")
+	}
+	return nil
+}
+
+// Builtins returns sorted names of builtin functions
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Constants returns sorted names of builtin constants with their symbols
+func Constants() []string {
+	names := make([]string, 0, len(constants)+len(constantAliases))
+	for name := range constants {
+		names = append(names, name)
+	}
+	for alias := range constantAliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
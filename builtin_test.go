@@ -0,0 +1,86 @@
+package gocalc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltins(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+	tests := []struct {
+		expr string
+		ans  float64
+	}{
+		{"@sqrt(16)", 4},
+		{"@abs(-2.5)", 2.5},
+		{"@exp(0)", 1},
+		{"@ln(e)", 1},
+		{"@log10(1000)", 3},
+		{"@log(8, 2)", 3},
+		{"@sin(pi / 2)", 1},
+		{"@cos(0)", 1},
+		{"@tan(0)", 0},
+		{"@asin(1)", math.Pi / 2},
+		{"@acos(1)", 0},
+		{"@atan(1)", math.Pi / 4},
+		{"@sinh(0) + @cosh(0) + @tanh(0)", 1},
+		{"@floor(-1.5)", -2},
+		{"@ceil(-1.5)", -1},
+		{"@round(2.5)", 3},
+		{"@trunc(-2.7)", -2},
+		{"@min(3)", 3},
+		{"@min(3, -1, 2)", -1},
+		{"@max(3, -1, 2, 10 / 2)", 5},
+		{"@hypot(3, 4)", 5},
+		{"@atan2(1, 1)", math.Pi / 4},
+		{"@sign(-3) + @sign(0) * 10 + @sign(5) * 100", 99},
+		{"phi * phi - phi", 1},
+		{"@sqrt(@max(@hypot(3, 4), 1) * 5)", 5},
+	}
+
+	for _, test := range tests {
+		res, err := ir.Eval(test.expr)
+		if ass.NoError(err, test.expr) {
+			ass.InDelta(test.ans, res, 1e-12, test.expr)
+		}
+	}
+
+	for _, expr := range []string{"@min()", "@sqrt(1, 2)", "@log(2)", "@hypot(1)"} {
+		_, err := ir.Eval(expr)
+		ass.Error(err, expr)
+	}
+}
+
+func TestBuiltinsProtection(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+
+	ass.Equal("error: at index 0: @sqrt is builtin function (use := to override)", ir.ProcessInstruction("@sqrt = (x): x"))
+	ass.Equal("error: at index 0: pi is constant (use := to override)", ir.ProcessInstruction("pi = 3"))
+	ass.Equal("", ir.ProcessInstruction("@sqrt := (x): x"))
+	ass.Equal("", ir.ProcessInstruction("pi := 3"))
+	ass.Equal("9", ir.ProcessInstruction("@sqrt(pi * 3)"))
+	ass.Equal("", ir.ProcessInstruction("pi = 4"))
+	ass.Equal("", ir.ProcessInstruction("@sqrt = (x): x * 2"))
+	ass.Equal("8", ir.ProcessInstruction("@sqrt(pi)"))
+
+	ass.True(ir.DeleteVar("pi"))
+	ass.True(ir.DeleteFunc("sqrt"))
+	ass.Equal("2", ir.ProcessInstruction("@sqrt(pi + 1 - pi + 3)"))
+
+	ass.Error(ir.DefineFunc("abs", []string{"x"}, "x"))
+}
+
+func TestCompleter(t *testing.T) {
+	ir := NewInterpreter(true, 0)
+	ass := assert.New(t)
+	ir.ProcessInstruction("@sinc = (x): @sin(x) / x")
+	ir.ProcessInstruction("pinned = 1")
+
+	ass.Equal([]string{"", "@sin", "@sinc", "@sinh"}, ir.completer("@sin", "", 0, 0))
+	ass.Equal([]string{"", "phi", "pi", "pinned"}, ir.completer("p", "", 0, 0))
+	ass.Equal([]string{"", "NO MATCHES"}, ir.completer("zz", "", 0, 0))
+}
@@ -1,16 +1,37 @@
 package gocalc
 
 // calculateExpression calculates expression in infix notation represented with string
-func (ir *Interpreter) calculateExpression(tokens []*Token) (float64, error) {
-	postfixTokens, err := ir.infixToPostfix(tokens)
+func (ir *Interpreter) calculateExpression(tokens []*Token) (Value, error) {
+	tree, err := ir.parse(tokens)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	if err := ir.checkTree(tree); err != nil {
+		return nil, err
+	}
+	postfixTokens := tree.Postfix()
 
 	res, err := ir.calculatePostfix(postfixTokens)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	return res, nil
 }
+
+// checkTree reports all unknown variables and bad calls of expression together
+func (ir *Interpreter) checkTree(tree *Node) error {
+	errs := ErrorList{}
+	tree.Walk(func(n *Node) {
+		switch n.Kind {
+		case NodeVariable:
+			if _, ok := ir.lookupVar(n.Tok.Variable, nil); !ok {
+				errs.add(tokenError(n.Tok, "unknown variable: %v", n.Tok))
+			}
+		case NodeCall:
+			errs.addAll(ir.checkCall(n.Tok))
+		}
+	})
+	errs.sort()
+	return errs.Err()
+}
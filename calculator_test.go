@@ -8,7 +8,7 @@ import (
 )
 
 func TestCalculateExpression(t *testing.T) {
-	var ir = &Interpreter{}
+	var ir = &Interpreter{num: floatNumeric{}}
 	ass := assert.New(t)
 
 	tests := []struct {
@@ -27,12 +27,66 @@ func TestCalculateExpression(t *testing.T) {
 		{"( (2 - 4) *-1 * 3 * (2 + 3)) / 5", 6},
 		{"55.66 - 55.66 + 22.4+ 2/2 * 110", 132.4},
 		{"53 / 2 - 6.5 - 15.55", 4.45},
+		{"-2^2", -4},
+		{"(-2)^2", 4},
+		{"2^3^2", 512},
+		{"2^-1", 0.5},
+		{"-2^-2*4", -1},
+		{"7 % 3", 1},
+		{"-7 % 3", 2},
+		{"7 % -3", -2},
+		{"5.5 % 2", 1.5},
+		{"7 // 2", 3},
+		{"-7 // 2", -4},
+		{"-7 // 2 * 2 + -7 % 2", -7},
+		{"1 + 2 * 3 ^ 2 % 4", 3},
+		{"0x10 + 0b11 * 0o10 - 1_000", -960},
+		{"1.5e3 / .5e1", 300},
 	}
 
 	for _, test := range tests {
 		tokens, _ := NewStringTokenizer(test.expr).Tokens()
 		actualAns, err := ir.calculateExpression(tokens)
 		ass.NoError(err)
-		ass.True(math.Abs(actualAns-test.ans) < 2e-14, "exp=%v act=%v", test.ans, actualAns)
+		ass.True(math.Abs(actualAns.(float64)-test.ans) < 2e-14, "exp=%v act=%v", test.ans, actualAns)
 	}
 }
+
+func TestImplicitMul(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	tests := []struct {
+		input, output string
+	}{
+		{"x = 3", ""},
+		{"2x", "error: at index 1: missing operator before x"},
+		{";implicit", "implicit multiplication: off"},
+		{";implicit on", ""},
+		{";implicit", "implicit multiplication: on"},
+		{"2x", "6.00"},
+		{"2x^2", "18.00"},
+		{"(2x)^2", "36.00"},
+		{"1/2x", "1.50"},
+		{"3(x + 1)", "12.00"},
+		{"(x + 1)(x - 1)", "8.00"},
+		{"2pi", "6.28"},
+		{"@sq = (a): a a", ""},
+		{"2@sq(x)", "18.00"},
+		{"@f = (a, b): 2a + 3b", ""},
+		{"2 3", "error: at index 2: missing operator before 3"},
+		{";implicit off", ""},
+		{"@f(1, 2)", "8.00"},
+		{";mem orig", "memory:\nx\t= 3.00\n@f\t= (a, b): 2 * a + 3 * b\n@sq\t= (a): a * a\n"},
+		{"2x", "error: at index 1: missing operator before x"},
+		{";implicit maybe", "error: at index 0: unknown switch maybe"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.input), test.input)
+	}
+
+	ir.SetImplicitMul(true)
+	ass.True(ir.ImplicitMul())
+	ass.NoError(ir.SetMode(ModeInt, 0))
+	ass.Equal("12", ir.ProcessInstruction("2x(x - 1)"))
+	ass.Equal("7", ir.ProcessInstruction("2x ^ 1")) // xor in integer modes
+}
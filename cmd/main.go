@@ -1,16 +1,72 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 
 	"github.com/TuM0xA-S/gocalc"
 )
 
+// maxCallDepth limits -d, deeper calls could exhaust stack
+const maxCallDepth = 100000
+
+// defaultInitFile returns path of init file in user config directory
+func defaultInitFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gocalc", "init.calc")
+}
+
 func main() {
 	script := flag.Bool("s", false, "script mode")
 	precision := flag.Int("p", 2, "precision")
+	depth := flag.Int("d", gocalc.DefaultMaxCallDepth, fmt.Sprintf("max depth of function calls (up to %d)", maxCallDepth))
+	initFile := flag.String("c", defaultInitFile(), "init file with predefined variables and functions")
+	noInit := flag.Bool("n", false, "do not load init file")
+	mode := flag.String("mode", gocalc.ModeFloat, "numeric mode (float, big, rat, complex, int, uint, bigint, unit)")
+	bits := flag.Uint("bits", 0, "mantissa precision of big mode or size of int and uint modes in bits (0 for default)")
 	flag.Parse()
 
-	gocalc.NewInterpreter(!*script, *precision).Start(os.Stdin, os.Stdout)
+	if *depth < 0 {
+		fmt.Fprintln(os.Stderr, "max depth of function calls can't be negative")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *depth > maxCallDepth {
+		fmt.Fprintf(os.Stderr, "max depth of function calls is limited to %d\n", maxCallDepth)
+		*depth = maxCallDepth
+	}
+
+	ir := gocalc.NewInterpreter(!*script, *precision)
+	ir.SetMaxCallDepth(*depth)
+	if err := ir.SetMode(*mode, *bits); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if !*noInit && *initFile != "" {
+		err := ir.LoadInitFile(*initFile, os.Stdout)
+		// missing default init file is fine
+		if err != nil && (isFlagSet("c") || !errors.Is(err, fs.ErrNotExist)) {
+			fmt.Fprintln(os.Stderr, "init file:", err)
+		}
+	}
+
+	ir.Start(os.Stdin, os.Stdout)
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
@@ -0,0 +1,394 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Command is meta command of interpreter, it is executed as ;name args
+type Command struct {
+	Usage string // arguments, like "[orig] [hist]"
+	Help  string // one line description
+	// Run executes command with arguments split by spaces (quoted argument can have spaces),
+	// errors are reported at position of command
+	Run func(ir *Interpreter, args []string) (string, error)
+}
+
+// runError is error of command execution (not of its arguments), it is reported as is
+type runError struct {
+	err error
+}
+
+func (e runError) Error() string {
+	return e.err.Error()
+}
+
+// commands are meta commands available in every interpreter
+var commands map[string]*Command
+
+// commands run interpreter, so they are set at init
+func init() {
+	commands = map[string]*Command{
+		"mem": {"[orig] [hist]", "show variables and functions (orig: as declared, hist: with history)", cmdMem},
+		"vars": {"", "show variables", func(ir *Interpreter, args []string) (string, error) {
+			if len(args) > 0 {
+				return "", errors.New("unexpected arguments")
+			}
+			buf := &strings.Builder{}
+			fmt.Fprintln(buf, "variables:")
+			ir.printVars(buf)
+			return strings.TrimSuffix(buf.String(), "\n"), nil
+		}},
+		"funcs": {"[orig]", "show functions (orig: as declared)", func(ir *Interpreter, args []string) (string, error) {
+			original, _, err := memOptions(args, false)
+			if err != nil {
+				return "", err
+			}
+			buf := &strings.Builder{}
+			fmt.Fprintln(buf, "functions:")
+			ir.printFuncs(buf, original)
+			return strings.TrimSuffix(buf.String(), "\n"), nil
+		}},
+		"del":   {"name...", "delete variables and functions (@name)", cmdDel},
+		"clear": {"", "delete all variables and functions", cmdClear},
+		"hist": {"[clear]", "show numbered results or forget them", func(ir *Interpreter, args []string) (string, error) {
+			switch {
+			case len(args) == 0:
+				return strings.TrimSuffix(ir.printHistory(), "\n"), nil
+			case len(args) == 1 && args[0] == "clear":
+				ir.ClearHistory()
+				return "", nil
+			}
+			return "", errors.New("expected clear")
+		}},
+		"builtins": {"", "show builtin functions and constants", cmdBuiltins},
+		"units":    {"", "show units of unit mode", cmdUnits},
+		"reload": {"", "execute init file again", func(ir *Interpreter, args []string) (string, error) {
+			if ir.initFile == "" {
+				return "", runError{errors.New("no init file")}
+			}
+			buf := &strings.Builder{}
+			if err := ir.LoadInitFile(ir.initFile, buf); err != nil {
+				return "", runError{err}
+			}
+			return strings.TrimSuffix(buf.String(), "\n"), nil
+		}},
+		"save": {"file", "save variables and functions to file as script", func(ir *Interpreter, args []string) (string, error) {
+			if len(args) == 0 {
+				return "", errors.New("expected file name")
+			}
+			if err := ir.SaveFile(strings.Join(args, " ")); err != nil {
+				return "", runError{err}
+			}
+			return "", nil
+		}},
+		"load": {"file", "execute script saved with ;save", func(ir *Interpreter, args []string) (string, error) {
+			if len(args) == 0 {
+				return "", errors.New("expected file name")
+			}
+			report, err := ir.LoadFile(strings.Join(args, " "))
+			if err != nil {
+				return "", runError{err}
+			}
+			return report.String(), nil
+		}},
+		"bind": {"[late|capture]", "show or set binding of globals for new functions", func(ir *Interpreter, args []string) (string, error) {
+			return nameSetting(args, "binding", "binding mode", bindingNames, ir.binding, ir.SetBinding)
+		}},
+		"frac": {"[fraction|mixed|decimal]", "show or set output of rat mode", func(ir *Interpreter, args []string) (string, error) {
+			return nameSetting(args, "fractions", "style of fractions", fracStyleNames, ir.fracStyle, ir.SetFracStyle)
+		}},
+		"format": {"[fixed|sci|eng|auto]", "show or set format of numbers", func(ir *Interpreter, args []string) (string, error) {
+			return nameSetting(args, "format", "format", numFormatNames, ir.numFormat, ir.SetNumberFormat)
+		}},
+		"implicit": {"[on|off]", "show or set implicit multiplication (2x, 3(a + b), (a + b)(a - b))", func(ir *Interpreter, args []string) (string, error) {
+			on := 0
+			if ir.implicit {
+				on = 1
+			}
+			return nameSetting(args, "implicit multiplication", "switch", switchNames, on, func(on int) {
+				ir.SetImplicitMul(on == 1)
+			})
+		}},
+		"overflow": {"[error|wrap]", "show or set overflow of int and uint modes", func(ir *Interpreter, args []string) (string, error) {
+			return nameSetting(args, "overflow", "overflow behavior", overflowNames, ir.overflow, ir.SetOverflow)
+		}},
+		"base": {"[2|8|10|16]", "show or set base of output in integer modes", func(ir *Interpreter, args []string) (string, error) {
+			switch len(args) {
+			case 0:
+				return fmt.Sprintf("base: %d", ir.base), nil
+			case 1:
+			default:
+				return "", errors.New("expected base")
+			}
+			base, err := strconv.Atoi(args[0])
+			if err != nil {
+				return "", fmt.Errorf("bad base %s", args[0])
+			}
+			return "", ir.SetBase(base)
+		}},
+		"precision": {"[digits]", "show or set digits after point in results", func(ir *Interpreter, args []string) (string, error) {
+			switch len(args) {
+			case 0:
+				return fmt.Sprintf("precision: %d", ir.precision), nil
+			case 1:
+			default:
+				return "", errors.New("expected precision")
+			}
+			prec, err := strconv.Atoi(args[0])
+			if err != nil || prec < 0 {
+				return "", fmt.Errorf("bad precision %s", args[0])
+			}
+			ir.SetPrecision(prec)
+			return "", nil
+		}},
+		"bits": {"", "show binary layout of last result", func(ir *Interpreter, args []string) (string, error) {
+			return ir.Bits()
+		}},
+		"mode": {"[mode [bits]]", "show or set numeric mode (float, big, rat, complex, int, uint, bigint, unit)", cmdMode},
+		"quit": {"", "stop interpreter", func(ir *Interpreter, args []string) (string, error) {
+			ir.done = true
+			return "", nil
+		}},
+		"help": {"[command]", "show commands or usage of command", cmdHelp},
+	}
+}
+
+var switchNames = map[int]string{
+	0: "off",
+	1: "on",
+}
+
+// nameSetting shows or sets setting with named values
+func nameSetting(args []string, title, noun string, names map[int]string, current int, set func(int)) (string, error) {
+	if len(args) == 0 {
+		return fmt.Sprintf("%s: %s", title, names[current]), nil
+	}
+	if len(args) > 1 {
+		return "", fmt.Errorf("expected %s", noun)
+	}
+	for val, name := range names {
+		if name == args[0] {
+			set(val)
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("unknown %s %s", noun, args[0])
+}
+
+// memOptions parses options of ;mem and ;funcs
+func memOptions(args []string, histAllowed bool) (original, hist bool, err error) {
+	for _, arg := range args {
+		switch {
+		case arg == "orig":
+			original = true
+		case arg == "hist" && histAllowed:
+			hist = true
+		default:
+			return false, false, fmt.Errorf("unknown option %s", arg)
+		}
+	}
+	return original, hist, nil
+}
+
+func cmdMem(ir *Interpreter, args []string) (string, error) {
+	original, hist, err := memOptions(args, true)
+	if err != nil {
+		return "", err
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintln(buf, "memory:")
+	ir.printVars(buf)
+	ir.printFuncs(buf, original)
+	if hist {
+		buf.WriteString(ir.printHistory())
+	}
+	return buf.String(), nil
+}
+
+func cmdDel(ir *Interpreter, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("expected names")
+	}
+	// nothing is deleted if some name is unknown
+	for _, name := range args {
+		if fn := strings.TrimPrefix(name, "@"); fn != name {
+			if _, ok := ir.funcs[fn]; !ok {
+				return "", fmt.Errorf("unknown function %s", name)
+			}
+		} else if _, ok := ir.vars[name]; !ok {
+			return "", fmt.Errorf("unknown variable %s", name)
+		}
+	}
+	for _, name := range args {
+		if fn := strings.TrimPrefix(name, "@"); fn != name {
+			ir.DeleteFunc(fn)
+		} else {
+			ir.DeleteVar(name)
+		}
+	}
+	return "", nil
+}
+
+func cmdClear(ir *Interpreter, args []string) (string, error) {
+	if len(args) > 0 {
+		return "", errors.New("unexpected arguments")
+	}
+	ir.vars = map[string]Value{}
+	ir.funcs = map[string]*function{}
+	return "", nil
+}
+
+func cmdBuiltins(ir *Interpreter, args []string) (string, error) {
+	buf := &strings.Builder{}
+	fmt.Fprintln(buf, "functions:")
+	for _, k := range Builtins() {
+		fmt.Fprintf(buf, "@%s ", k)
+	}
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "constants:")
+	for _, k := range ir.constantNames() {
+		val, _ := ir.constant(k)
+		fmt.Fprintf(buf, "%s\t= %s\n", k, ir.Format(val))
+	}
+	return buf.String(), nil
+}
+
+func cmdMode(ir *Interpreter, args []string) (string, error) {
+	if len(args) == 0 {
+		return fmt.Sprintf("mode: %s", ir.modeString()), nil
+	}
+	if len(args) > 2 {
+		return "", errors.New("expected mode and precision")
+	}
+	prec := uint64(0)
+	if len(args) == 2 {
+		var err error
+		if prec, err = strconv.ParseUint(args[1], 10, 0); err != nil {
+			return "", fmt.Errorf("bad precision %s", args[1])
+		}
+	}
+	return "", ir.SetMode(args[0], uint(prec))
+}
+
+func cmdHelp(ir *Interpreter, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("expected command")
+	}
+	if len(args) == 1 {
+		name := strings.TrimPrefix(args[0], ";")
+		cmd, ok := ir.command(name)
+		if !ok {
+			return "", fmt.Errorf("unknown meta command ;%s", name)
+		}
+		return fmt.Sprintf("%s\n%s", commandUsage(name, cmd), cmd.Help), nil
+	}
+	lines := []string{"commands:"}
+	for _, name := range ir.Commands() {
+		cmd, _ := ir.command(name)
+		lines = append(lines, fmt.Sprintf("%s\t%s", commandUsage(name, cmd), cmd.Help))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func commandUsage(name string, cmd *Command) string {
+	if cmd.Usage == "" {
+		return ";" + name
+	}
+	return ";" + name + " " + cmd.Usage
+}
+
+// splitArgs splits arguments of command by spaces, double quoted argument can have spaces
+func splitArgs(s string) ([]string, error) {
+	args := []string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] != '"' {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			args = append(args, s[:end])
+			s = s[end:]
+			continue
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated quote")
+		}
+		args = append(args, s[1:end+1])
+		s = s[end+2:]
+	}
+	return args, nil
+}
+
+// command returns meta command registered in interpreter or builtin one
+func (ir *Interpreter) command(name string) (*Command, bool) {
+	if cmd, ok := ir.commands[name]; ok {
+		return cmd, true
+	}
+	cmd, ok := commands[name]
+	return cmd, ok
+}
+
+// RegisterCommand adds meta command ;name to interpreter, builtin commands can't be replaced
+func (ir *Interpreter) RegisterCommand(name string, cmd *Command) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid command name %q", name)
+	}
+	if _, ok := commands[name]; ok {
+		return fmt.Errorf(";%s is builtin command", name)
+	}
+	if cmd == nil || cmd.Run == nil {
+		return fmt.Errorf(";%s has nothing to run", name)
+	}
+	if ir.commands == nil {
+		ir.commands = map[string]*Command{}
+	}
+	ir.commands[name] = cmd
+	return nil
+}
+
+// Commands returns sorted names of meta commands
+func (ir *Interpreter) Commands() []string {
+	names := make([]string, 0, len(commands)+len(ir.commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	for name := range ir.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProcessMetaCommand processes meta command
+func (ir *Interpreter) ProcessMetaCommand(token *Token) (string, error) {
+	if token.Type != TokenMetaCommand {
+		return "", fmt.Errorf("not a meta command")
+	}
+	cmd, ok := ir.command(token.Command)
+	if !ok {
+		return "", tokenError(token, "unknown meta command ;%s", token.Command)
+	}
+	args, err := splitArgs(token.CommandArgs)
+	if err != nil {
+		return "", tokenError(token, "%v", err)
+	}
+	out, err := cmd.Run(ir, args)
+	var rerr runError
+	switch {
+	case err == nil:
+		return out, nil
+	case errors.As(err, &rerr):
+		return "", rerr.err
+	}
+	return "", tokenError(token, "%v", err)
+}
+
+// Done reports if interpreter was stopped with ;quit
+func (ir *Interpreter) Done() bool {
+	return ir.done
+}
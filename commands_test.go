@@ -0,0 +1,144 @@
+package gocalc
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommands(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	tests := []struct {
+		input, output string
+	}{
+		{"a = 1", ""},
+		{"b = 2", ""},
+		{"@f = (x): x + a", ""},
+		{"@g = (x): x * 1", ""},
+		{";vars", "variables:\na\t= 1.00\nb\t= 2.00"},
+		{";funcs", "functions:\n@f\t= (x): x + a\t[uses: a]\n@g\t= (x): x"},
+		{";funcs orig", "functions:\n@f\t= (x): x + a\t[uses: a]\n@g\t= (x): x * 1"},
+		{";funcs hist", "error: at index 0: unknown option hist"},
+		{";vars a", "error: at index 0: unexpected arguments"},
+		{";del a @g", ""},
+		{";mem", "memory:\nb\t= 2.00\n@f\t= (x): x + a\t[uses: a]\n"},
+		{";del b @x", "error: at index 0: unknown function @x"},
+		{";del c", "error: at index 0: unknown variable c"},
+		{";del", "error: at index 0: expected names"},
+		{";vars", "variables:\nb\t= 2.00"},
+		{";clear", ""},
+		{";mem", "memory:\n"},
+		{";precision", "precision: 2"},
+		{";precision 4", ""},
+		{"1 / 3", "0.3333"},
+		{";precision -1", "error: at index 0: bad precision -1"},
+		{";precision 1 2", "error: at index 0: expected precision"},
+		{";format", "format: fixed"},
+		{";format sci", ""},
+		{"1234.5", "1.2345e+03"},
+		{";format eng", ""},
+		{"123456", "123.4560e+03"},
+		{";format auto", ""},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{";format exact", "error: at index 0: unknown format exact"},
+		{";mode", "mode: float"},
+		{";mode big 128", ""},
+		{";mode", "mode: big 128"},
+		{";mode rat 1 2", "error: at index 0: expected mode and precision"},
+		{";bind", "binding: late"},
+		{";unknown", "error: at index 0: unknown meta command ;unknown"},
+		{`;save "a`, "error: at index 0: unterminated quote"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.input), test.input)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	help := ir.ProcessInstruction(";help")
+	ass.True(strings.HasPrefix(help, "commands:\n;base [2|8|10|16]\t"), help)
+	for _, name := range ir.Commands() {
+		ass.Contains(help, "\n;"+name, name)
+	}
+	ass.Equal(";del name...\ndelete variables and functions (@name)", ir.ProcessInstruction(";help del"))
+	ass.Equal(";quit\nstop interpreter", ir.ProcessInstruction(";help ;quit"))
+	ass.Equal("error: at index 0: unknown meta command ;x", ir.ProcessInstruction(";help x"))
+}
+
+func TestRegisterCommand(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	echo := &Command{
+		Usage: "words...",
+		Help:  "print words",
+		Run: func(ir *Interpreter, args []string) (string, error) {
+			if len(args) == 0 {
+				return "", errors.New("nothing to print")
+			}
+			return strings.Join(args, "|"), nil
+		},
+	}
+	ass.NoError(ir.RegisterCommand("echo", echo))
+	ass.EqualError(ir.RegisterCommand("mem", echo), ";mem is builtin command")
+	ass.EqualError(ir.RegisterCommand("a b", echo), `invalid command name "a b"`)
+	ass.EqualError(ir.RegisterCommand("nop", &Command{}), ";nop has nothing to run")
+
+	ass.Equal(`a|b c|d`, ir.ProcessInstruction(`;echo a  "b c" d`))
+	ass.Equal("error: at index 0: nothing to print", ir.ProcessInstruction(";echo"))
+	ass.Contains(ir.ProcessInstruction(";help"), "\n;echo words...\tprint words\n")
+	ass.Contains(ir.Commands(), "echo")
+	ass.Equal([]string{";echo"}, ir.completer(";e", ";e", 0, 2))
+
+	// commands are registered per interpreter
+	ass.Equal("error: at index 0: unknown meta command ;echo", NewInterpreter(false, 2).ProcessInstruction(";echo a"))
+}
+
+func TestQuit(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 1)
+	buf := &strings.Builder{}
+	ass.NoError(ir.RunScript("", strings.NewReader("1\n;quit\n2\n"), buf))
+	ass.Equal("1.0\n", buf.String())
+	ass.True(ir.Done())
+}
+
+func TestNumberFormat(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		style  int
+		f      float64
+		output string
+	}{
+		{FormatFixed, 1234.5678, "1234.57"},
+		{FormatSci, 1234.5678, "1.23e+03"},
+		{FormatSci, -0.000123, "-1.23e-04"},
+		{FormatEng, 1234.5678, "1.23e+03"},
+		{FormatEng, 0.000123, "123.00e-06"},
+		{FormatEng, -12.5, "-12.50e+00"},
+		{FormatEng, 999.999, "1.00e+03"},
+		{FormatEng, 0.9999, "1.00e+00"},
+		{FormatEng, 1e-300, "1.00e-300"},
+		{FormatEng, 0, "0.00e+00"},
+		{FormatAuto, 1234.5678, "1234.5678"},
+		{FormatAuto, 1e21, "1e+21"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, formatFloat(test.f, test.style, 2), test.f)
+		ass.Equal(test.output, formatBig(big.NewFloat(test.f), test.style, 2), test.f)
+	}
+
+	ir := NewInterpreter(false, 2)
+	ir.SetNumberFormat(FormatSci)
+	ass.Equal(FormatSci, ir.NumberFormat())
+	ass.NoError(ir.SetMode(ModeComplex, 0))
+	ass.Equal("1.00e+00-2.50e+03i", ir.ProcessInstruction("1 - 2500i"))
+	ass.Equal("2.00e+00i", ir.ProcessInstruction("2i"))
+	ass.NoError(ir.SetMode(ModeRat, 0))
+	ass.Equal("1/3", ir.ProcessInstruction("1/3"))
+}
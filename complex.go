@@ -0,0 +1,304 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+)
+
+var (
+	errNotReal = errors.New("value is not real")
+	errImag    = errors.New("imaginary number needs complex mode")
+)
+
+// complexConstants are constants of complex mode only
+var complexConstants = map[string]complex128{
+	"i": 1i,
+}
+
+func complexUnary(fn func(complex128) complex128) func([]complex128) complex128 {
+	return func(args []complex128) complex128 {
+		return fn(args[0])
+	}
+}
+
+// complexRound applies rounding to both parts
+func complexRound(fn func(float64) float64) func([]complex128) complex128 {
+	return func(args []complex128) complex128 {
+		return complex(fn(real(args[0])), fn(imag(args[0])))
+	}
+}
+
+// complexBuiltins are implementations of builtins for complex arguments
+// (builtins without them need real arguments)
+var complexBuiltins = map[string]func(args []complex128) complex128{
+	"sqrt":  complexUnary(cmplx.Sqrt),
+	"exp":   complexUnary(cmplx.Exp),
+	"ln":    complexUnary(cmplx.Log),
+	"log10": complexUnary(cmplx.Log10),
+	"log": func(args []complex128) complex128 {
+		return cmplx.Log(args[0]) / cmplx.Log(args[1])
+	},
+	"sin":  complexUnary(cmplx.Sin),
+	"cos":  complexUnary(cmplx.Cos),
+	"tan":  complexUnary(cmplx.Tan),
+	"asin": complexUnary(cmplx.Asin),
+	"acos": complexUnary(cmplx.Acos),
+	"atan": complexUnary(cmplx.Atan),
+	"sinh": complexUnary(cmplx.Sinh),
+	"cosh": complexUnary(cmplx.Cosh),
+	"tanh": complexUnary(cmplx.Tanh),
+	"abs": complexUnary(func(z complex128) complex128 {
+		return complex(cmplx.Abs(z), 0)
+	}),
+	"arg": complexUnary(func(z complex128) complex128 {
+		return complex(cmplx.Phase(z), 0)
+	}),
+	"re": complexUnary(func(z complex128) complex128 {
+		return complex(real(z), 0)
+	}),
+	"im": complexUnary(func(z complex128) complex128 {
+		return complex(imag(z), 0)
+	}),
+	"conj": complexUnary(cmplx.Conj),
+	"polar": func(args []complex128) complex128 {
+		return args[0] * cmplx.Exp(1i*args[1])
+	},
+	"sign": complexUnary(func(z complex128) complex128 {
+		return z / complex(cmplx.Abs(z), 0)
+	}),
+	"floor": complexRound(math.Floor),
+	"ceil":  complexRound(math.Ceil),
+	"round": complexRound(math.Round),
+	"trunc": complexRound(math.Trunc),
+}
+
+// complexNumeric is arithmetic of complex mode, values are complex128
+// real values are calculated like in float mode
+type complexNumeric struct {
+	style int // format of output
+}
+
+func (complexNumeric) mode() (string, uint) {
+	return ModeComplex, 0
+}
+
+func (complexNumeric) number(tok *Token) (Value, error) {
+	if tok.Imag {
+		return complex(0, tok.Number), nil
+	}
+	return complex(tok.Number, 0), nil
+}
+
+func (complexNumeric) convert(v Value) (Value, error) {
+	if z, ok := v.(complex128); ok {
+		return z, nil
+	}
+	return complex(toFloat64(v), 0), nil
+}
+
+func (complexNumeric) float(v Value) float64 {
+	return toFloat64(v)
+}
+
+func (complexNumeric) truth(v Value) bool {
+	return v.(complex128) != 0
+}
+
+func (complexNumeric) constant(name string) (Value, bool) {
+	if val, ok := complexConstants[name]; ok {
+		return val, true
+	}
+	val, ok := constants[name]
+	return complex(val, 0), ok
+}
+
+func (complexNumeric) unary(op string, a Value) (Value, error) {
+	switch op {
+	case "u+":
+		return a, nil
+	case "u-":
+		return realZero(-a.(complex128)), nil
+	}
+	return nil, opError(op)
+}
+
+func (complexNumeric) binary(op string, a, b Value) (Value, error) {
+	x, y := a.(complex128), b.(complex128)
+	pow := op == "^" || op == "**"
+	if imag(x) == 0 && imag(y) == 0 && (!pow || real(x) >= 0 || real(y) == math.Trunc(real(y))) {
+		res, ok := applyOperator(op, real(x), real(y))
+		if !ok {
+			return nil, opError(op)
+		}
+		return complex(res, 0), nil
+	}
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, errDivZero
+		}
+		return x / y, nil
+	case "^", "**":
+		if n := real(y); imag(y) == 0 && n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+			return complexPowInt(x, int64(n)), nil
+		}
+		return cmplx.Pow(x, y), nil
+	case "==":
+		return complex(boolFloat(x == y), 0), nil
+	case "!=":
+		return complex(boolFloat(x != y), 0), nil
+	case "//", "%", "<", "<=", ">", ">=":
+		return nil, fmt.Errorf("%s needs real operands", op)
+	}
+	return nil, opError(op)
+}
+
+// realZero replaces -0 imaginary part of real number with 0
+// (sign of zero chooses side of branch cut in sqrt and ln)
+func realZero(z complex128) complex128 {
+	if imag(z) == 0 {
+		return complex(real(z), 0)
+	}
+	return z
+}
+
+// complexPowInt calculates x^n by squaring, so powers of i are exact
+func complexPowInt(x complex128, n int64) complex128 {
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	res := complex(1, 0)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			res *= x
+		}
+		x *= x
+	}
+	if neg {
+		return 1 / res
+	}
+	return res
+}
+
+// call calculates builtin like in float mode if arguments are real and result is real,
+// otherwise with complex implementation
+func (complexNumeric) call(name string, args []Value) (Value, error) {
+	zs := make([]complex128, len(args))
+	floats := make([]float64, len(args))
+	isReal := true
+	for i, arg := range args {
+		zs[i] = arg.(complex128)
+		floats[i] = real(zs[i])
+		isReal = isReal && imag(zs[i]) == 0
+	}
+	fn, ok := complexBuiltins[name]
+	if isReal {
+		res := builtins[name].fn(floats)
+		if !math.IsNaN(res) || !ok {
+			return complex(res, 0), nil
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("@%s needs real arguments", name)
+	}
+	return fn(zs), nil
+}
+
+func (m complexNumeric) format(v Value, precision int) string {
+	z := v.(complex128)
+	re := formatFloat(real(z), m.style, precision)
+	im := formatFloat(imag(z), m.style, precision) + "i"
+	if !strings.HasPrefix(im, "-") && !strings.HasPrefix(im, "+") {
+		im = "+" + im
+	}
+	// parts rounded to zero are not shown
+	switch {
+	case isZeroText(im):
+		return re
+	case isZeroText(re):
+		return strings.TrimPrefix(im, "+")
+	}
+	return re + im
+}
+
+func (complexNumeric) literal(v Value) string {
+	z := v.(complex128)
+	re, im := real(z), imag(z)
+	if im == 0 {
+		return formatLiteral(re)
+	}
+	op := "+"
+	if im < 0 {
+		op, im = "-", -im
+	}
+	imLit := formatLiteral(im) + "i"
+	if math.IsInf(im, 0) || math.IsNaN(im) {
+		imLit = fmt.Sprintf("(%s) * i", formatLiteral(im))
+	}
+	switch {
+	case re != 0:
+		return fmt.Sprintf("%s %s %s", formatLiteral(re), op, imLit)
+	case op == "-":
+		return "-" + imLit
+	}
+	return imLit
+}
+
+func (complexNumeric) warnings() []string {
+	return nil
+}
+
+// isZeroText reports if formatted number is zero
+func isZeroText(s string) bool {
+	mant := s
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		mant = s[:i]
+	}
+	return strings.Trim(mant, "+-0.i") == ""
+}
+
+// constantNames returns sorted names of constants in numeric mode of interpreter
+func (ir *Interpreter) constantNames() []string {
+	names := Constants()
+	if _, ok := ir.num.(complexNumeric); ok {
+		for name := range complexConstants {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	return names
+}
+
+// constant returns value of constant (or constant named by symbol) in numeric mode of interpreter
+func (ir *Interpreter) constant(name string) (Value, bool) {
+	if alias, ok := constantAliases[name]; ok {
+		name = alias
+	}
+	return ir.num.constant(name)
+}
+
+// isConstant reports if name is constant in numeric mode of interpreter
+func (ir *Interpreter) isConstant(name string) bool {
+	for _, constant := range ir.constantNames() {
+		if constant == name {
+			return true
+		}
+	}
+	if ir.isUnitMode() {
+		// units are constants of unit mode
+		_, ok := lookupUnit(name)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package gocalc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Formats of numbers in output of float, big and complex modes
+const (
+	FormatFixed = iota // 1234.50 (precision digits after point)
+	FormatSci          // 1.23e+03
+	FormatEng          // 1.23e+03, exponent is multiple of 3
+	FormatAuto         // 1234.5, shortest form that gives same number
+)
+
+var numFormatNames = map[int]string{
+	FormatFixed: "fixed",
+	FormatSci:   "sci",
+	FormatEng:   "eng",
+	FormatAuto:  "auto",
+}
+
+// formatFloat formats f in format style with precision digits after point
+func formatFloat(f float64, style, precision int) string {
+	switch {
+	case style == FormatSci:
+		return strconv.FormatFloat(f, 'e', precision, 64)
+	case style == FormatAuto:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case style == FormatEng && !math.IsInf(f, 0) && !math.IsNaN(f):
+		return formatEng(new(big.Float).SetFloat64(f), precision)
+	}
+	return fmt.Sprintf("%.*f", precision, f)
+}
+
+// formatBig formats x in format style with precision digits after point
+func formatBig(x *big.Float, style, precision int) string {
+	switch style {
+	case FormatSci:
+		return x.Text('e', precision)
+	case FormatEng:
+		return formatEng(x, precision)
+	case FormatAuto:
+		return x.Text('g', -1)
+	}
+	return x.Text('f', precision)
+}
+
+// formatEng formats x with exponent multiple of 3 and mantissa from 1 to 1000
+func formatEng(x *big.Float, precision int) string {
+	if x.Sign() == 0 || x.IsInf() {
+		return x.Text('e', precision)
+	}
+	// exponent of rounded first digit, it can be greater by one than exponent of x
+	text := x.Text('e', 0)
+	exp, _ := strconv.Atoi(text[strings.IndexByte(text, 'e')+1:])
+	exp -= ((exp % 3) + 3) % 3
+	prec := x.MinPrec() + 64
+	for {
+		n := int64(exp)
+		if n < 0 {
+			n = -n
+		}
+		scale := new(big.Float).SetPrec(prec).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil))
+		m := new(big.Float).SetPrec(prec)
+		if exp >= 0 {
+			m.Quo(x, scale)
+		} else {
+			m.Mul(x, scale)
+		}
+		mant := m.Text('f', precision)
+		whole := strings.TrimPrefix(mant, "-")
+		whole = whole[:strings.IndexByte(whole+".", '.')]
+		switch {
+		case whole == "0":
+			exp -= 3
+		case len(whole) > 3:
+			exp += 3
+		default:
+			return fmt.Sprintf("%se%+03d", mant, exp)
+		}
+	}
+}
+
+// NumberFormat returns format of numbers in output of float, big and complex modes
+func (ir *Interpreter) NumberFormat() int {
+	return ir.numFormat
+}
+
+// SetNumberFormat sets format of numbers in output of float, big and complex modes
+// (FormatFixed, FormatSci, FormatEng, FormatAuto)
+func (ir *Interpreter) SetNumberFormat(style int) {
+	ir.numFormat = style
+	ir.num = ir.configure(ir.num)
+}
+
+// Precision returns digits after point in results
+func (ir *Interpreter) Precision() int {
+	return ir.precision
+}
+
+// SetPrecision sets digits after point in results
+func (ir *Interpreter) SetPrecision(precision int) {
+	ir.precision = precision
+}
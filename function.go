@@ -3,41 +3,267 @@ package gocalc
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 )
 
+// DefaultMaxCallDepth is used when interpreter has no max call depth set
+const DefaultMaxCallDepth = 1000
+
+var errCallDepth = errors.New("max call depth exceeded")
+
+// Binding modes of global variables in function bodies
+const (
+	BindLate    = iota // body sees current values of globals
+	BindCapture        // body sees values of globals at declaration
+)
+
+var bindingNames = map[int]string{
+	BindLate:    "late",
+	BindCapture: "capture",
+}
+
 type function struct {
-	params []string
-	body   []*Token
+	params   []string
+	body     []*Token
+	captured map[string]Value // globals captured at declaration (BindCapture)
+
+	// optimized body prepared on first use
+	tree        *Node
+	lets        []*Node // common subexpressions $1, $2...
+	postfix     []*Token
+	letsPostfix [][]*Token
+}
+
+// hasImag reports if tokens have imaginary number
+func hasImag(tokens []*Token) bool {
+	for _, tok := range tokens {
+		if tok.Imag {
+			return true
+		}
+	}
+	return false
 }
 
-func (f *function) call(args []float64) (float64, error) {
+// compile converts body to optimized postfix notation
+func (f *function) compile(ir *Interpreter) error {
+	if f.postfix != nil {
+		return nil
+	}
+	// body is expanded with operators of mode it is declared in
+	tree, err := Parse(f.body)
+	if err != nil {
+		return err
+	}
+	// optimizer calculates constants with float arithmetic
+	if _, ok := ir.num.(floatNumeric); ok && !hasImag(f.body) {
+		tree = optimize(tree)
+	}
+
+	f.tree, f.lets = extractCommon(tree)
+	f.letsPostfix = make([][]*Token, len(f.lets))
+	for i, let := range f.lets {
+		f.letsPostfix[i] = let.Postfix()
+	}
+	f.postfix = f.tree.Postfix()
+	return nil
+}
+
+// reset drops optimized body, so it is prepared again on next use
+func (f *function) reset() {
+	f.tree, f.lets = nil, nil
+	f.postfix, f.letsPostfix = nil, nil
+}
+
+// letName returns name of local variable with value of i-th common subexpression
+func letName(i int) string {
+	return fmt.Sprintf("$%d", i+1)
+}
+
+// call calculates function body with args as parameters
+// functions called from body are looked up in interpreter at call time
+func (f *function) call(ir *Interpreter, args []Value, depth int) (Value, error) {
 	if len(f.params) != len(args) {
-		return 0, errors.New("wrong argument count")
+		return nil, errors.New("wrong argument count")
+	}
+	if depth > ir.maxCallDepth() {
+		return nil, errCallDepth
+	}
+
+	if err := f.compile(ir); err != nil {
+		return nil, err
 	}
 
-	vars := map[string]float64{}
+	fr := &frame{
+		locals: make(map[string]Value, len(f.params)+len(f.lets)),
+		fn:     f,
+		depth:  depth,
+	}
 	for i := range f.params {
-		vars[f.params[i]] = args[i]
+		fr.locals[f.params[i]] = args[i]
 	}
+	for i, let := range f.letsPostfix {
+		val, err := ir.evalPostfix(let, fr)
+		if err != nil {
+			return nil, err
+		}
+		fr.locals[letName(i)] = val
+	}
+
+	return ir.evalPostfix(f.postfix, fr)
+}
 
-	interpreter := &Interpreter{
-		vars: vars,
+// callFunc calls user function or builtin named by tok from frame
+func (ir *Interpreter) callFunc(tok *Token, args []Value, fr *frame) (Value, error) {
+	if fn, ok := ir.funcs[tok.Function]; ok {
+		return ir.callFunction(tok, fn, args, fr)
 	}
+	if b, ok := builtins[tok.Function]; ok {
+		if err := b.checkArgc(len(args)); err != nil {
+			return nil, tokenError(tok, "call %s: %v", tok, err)
+		}
+		res, err := ir.num.call(tok.Function, args)
+		if err != nil {
+			return nil, tokenError(tok, "call %s: %v", tok, err)
+		}
+		return res, nil
+	}
+	return nil, tokenError(tok, "unknown function %s", tok)
+}
+
+// callFunction calls fn from frame, tok is token of call
+func (ir *Interpreter) callFunction(tok *Token, fn *function, args []Value, fr *frame) (Value, error) {
+	depth := 1
+	if fr != nil {
+		depth = fr.depth + 1
+	}
+	res, err := fn.call(ir, args, depth)
+	if errors.Is(err, errCallDepth) {
+		if fr != nil {
+			// report only at outermost call
+			return nil, err
+		}
+		return nil, tokenError(tok, "call %s: %v (%d)", tok, err, ir.maxCallDepth())
+	}
+	if err != nil {
+		return nil, tokenError(tok, "call %s: %s", tok, bodyErrorMessage(err))
+	}
+	return res, nil
+}
 
-	return interpreter.calculateExpression(f.body)
+// bodyErrorMessage returns message of error of function body without its position
+// (position is in declaration of function, not in input of call)
+func bodyErrorMessage(err error) string {
+	if perr, ok := err.(*Error); ok {
+		return perr.Msg
+	}
+	return err.Error()
+}
+
+func (ir *Interpreter) maxCallDepth() int {
+	if ir.maxDepth <= 0 {
+		return DefaultMaxCallDepth
+	}
+	return ir.maxDepth
+}
+
+// SetMaxCallDepth sets limit of nested function calls (0 sets DefaultMaxCallDepth)
+func (ir *Interpreter) SetMaxCallDepth(depth int) {
+	ir.maxDepth = depth
+}
+
+// globals returns sorted names of global variables used in body
+func (f *function) globals() []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, param := range f.params {
+		seen[param] = true
+	}
+	for _, tok := range f.body {
+		if tok.Type == TokenVariable && !seen[tok.Variable] {
+			seen[tok.Variable] = true
+			res = append(res, tok.Variable)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// capture saves current values of globals used in body
+func (f *function) capture(ir *Interpreter) error {
+	f.captured = map[string]Value{}
+	for _, tok := range f.body {
+		if tok.Type != TokenVariable || f.isParam(tok.Variable) {
+			continue
+		}
+		val, ok := ir.vars[tok.Variable]
+		if !ok {
+			val, ok = ir.historyValue(tok.Variable)
+		}
+		if !ok {
+			if ir.isConstant(tok.Variable) {
+				continue
+			}
+			return tokenError(tok, "capture: unknown variable: %s", tok.Variable)
+		}
+		f.captured[tok.Variable] = val
+	}
+	return nil
+}
+
+// SetBinding sets binding mode of globals for functions declared after
+func (ir *Interpreter) SetBinding(mode int) {
+	ir.binding = mode
 }
 
 func (f *function) String() string {
 	return fmt.Sprintf("(%s): %s", strings.Join(f.params, ", "), buildExprFromTokens(f.body))
 }
 
+// optimizedString returns function with optimized body
+// and its common subexpressions, like "(a): $1 * $1 where $1 = a + 1"
+func (f *function) optimizedString(ir *Interpreter) string {
+	if err := f.compile(ir); err != nil {
+		return f.String()
+	}
+	res := fmt.Sprintf("(%s): %s", strings.Join(f.params, ", "), f.tree)
+	if len(f.lets) > 0 {
+		lets := make([]string, len(f.lets))
+		for i, let := range f.lets {
+			lets[i] = fmt.Sprintf("%s = %s", letName(i), let)
+		}
+		res += " where " + strings.Join(lets, ", ")
+	}
+	return res
+}
+
 func (ir *Interpreter) processFunctionDeclaration(tokens []*Token) error {
+	function, err := ir.parseFunctionDeclaration(tokens)
+	if err != nil {
+		return err
+	}
+	if ir.binding == BindCapture {
+		if err := function.capture(ir); err != nil {
+			return err
+		}
+	}
+
+	ir.funcs[tokens[0].Function] = function
+
+	return nil
+}
+
+// parseFunctionDeclaration parses function declaration, all syntax errors of body are reported together
+func (ir *Interpreter) parseFunctionDeclaration(tokens []*Token) (*function, error) {
 	if len(tokens) < 3 || tokens[0].Type != TokenFunction ||
-		tokens[1].Operator != "=" ||
+		!isAssignment(tokens) ||
 		tokens[2].Operator != "(" {
 
-		return errors.New("not a function declaration")
+		return nil, tokensError(tokens, "not a function declaration")
+	}
+	name := tokens[0].Function
+	if _, ok := ir.funcs[name]; !ok && builtins[name] != nil && tokens[1].Operator != ":=" {
+		return nil, tokenError(tokens[0], "%s is builtin function (use := to override)", tokens[0])
 	}
 	function := &function{}
 	pos := 3
@@ -64,22 +290,25 @@ func (ir *Interpreter) processFunctionDeclaration(tokens []*Token) error {
 	}
 
 	if !ok {
-		return errors.New("bad parameter syntax")
+		end := 3
+		for end < len(tokens) && tokens[end].Delimiter != ":" {
+			end++
+		}
+		return nil, tokensError(tokens[2:end], "bad parameter syntax")
 	}
 
+	if pos >= len(tokens) {
+		last := tokens[len(tokens)-1]
+		return nil, newError(last.End, "bad body syntax")
+	}
 	if pos+1 >= len(tokens) || tokens[pos].Delimiter != ":" {
-		return errors.New("bad body syntax")
+		return nil, tokenError(tokens[pos], "bad body syntax")
 	}
 	pos++
-	function.body = tokens[pos:]
-	for pos < len(tokens) {
-		if tokens[pos].Type == TokenFunction {
-			return errors.New("subcalls not allowed")
-		}
-		pos++
+	// body stays the same if implicit multiplication is turned off or mode is changed
+	function.body = ir.expandTokens(tokens[pos:])
+	if _, err := Parse(function.body); err != nil {
+		return nil, err
 	}
-
-	ir.funcs[tokens[0].Function] = function
-
-	return nil
+	return function, nil
 }
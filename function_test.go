@@ -69,7 +69,119 @@ func TestFunctionCall(t *testing.T) {
 		},
 	}
 
-	res, err := f.call([]float64{3, 5})
+	res, err := f.call(NewInterpreter(false, 0), []Value{3.0, 5.0}, 1)
 	ass.NoError(err)
 	ass.EqualValues(11, res)
 }
+
+func TestNestedFunctionCalls(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+
+	// @hyp is declared before @sq
+	ass.Equal("", ir.ProcessInstruction("@hyp = (a, b): @sq(a) + @sq(b)"))
+	ass.Equal("", ir.ProcessInstruction("@sq = (x): x * x"))
+	ass.Equal("", ir.ProcessInstruction("@twice = (x): @hyp(x, @sq(x)) * 2"))
+
+	res, err := ir.Eval("@hyp(3, 4)")
+	ass.NoError(err)
+	ass.EqualValues(25, res)
+
+	res, err = ir.Eval("@twice(2)")
+	ass.NoError(err)
+	ass.EqualValues(40, res)
+
+	ass.NoError(ir.DefineFunc("sq", []string{"x"}, "x * x * x"))
+	res, err = ir.Eval("@hyp(1, 2)")
+	ass.NoError(err)
+	ass.EqualValues(9, res)
+}
+
+func TestRecursionDepth(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+	ass.NoError(ir.DefineFunc("inf", []string{"x"}, "@inf(x + 1)"))
+	ass.NoError(ir.DefineFunc("depth", []string{"x"}, "@nested(x)"))
+	ass.NoError(ir.DefineFunc("nested", []string{"x"}, "x + 1"))
+
+	ir.SetMaxCallDepth(10)
+	_, err := ir.Eval("1 + @inf(1)")
+	if ass.Error(err) {
+		ass.Equal("at index 4: call @inf: max call depth exceeded (10)", err.Error())
+	}
+
+	ir.SetMaxCallDepth(1)
+	_, err = ir.Eval("@depth(1)")
+	ass.Error(err)
+
+	ir.SetMaxCallDepth(2)
+	res, err := ir.Eval("@depth(1)")
+	ass.NoError(err)
+	ass.EqualValues(2, res)
+}
+
+func TestConditions(t *testing.T) {
+	ir := NewInterpreter(false, 2)
+	ass := assert.New(t)
+	ass.Equal("", ir.ProcessInstruction("@relu = (x): x > 0 ? x : 0"))
+	ass.Equal("", ir.ProcessInstruction("@fact = (n): n <= 1 ? 1 : n * @fact(n - 1)"))
+	ass.Equal("", ir.ProcessInstruction("@loop = (x): @loop(x)"))
+	tests := []struct {
+		expr, output string
+	}{
+		{"@relu(-3) + @relu(2.5)", "2.50"},
+		{"@fact(10)", "3628800.00"},
+		{"1 < 2 && 3 >= 3", "1.00"},
+		{"2 && 3", "1.00"},
+		{"0 || -5", "1.00"},
+		{"!0 + !5", "1.00"},
+		{"1 != 1 || 2 == 2", "1.00"},
+		// not taken branch and right operand are not calculated
+		{"0 && @loop(1)", "0.00"},
+		{"1 || @loop(1)", "1.00"},
+		{"1 ? 2 : @loop(1)", "2.00"},
+		{"0 ? 1 : 2 ? 3 : 4", "3.00"},
+		{"1 + 2 < 4 ? 10 : 20", "10.00"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.expr), test.expr)
+	}
+	ass.Contains(ir.ProcessInstruction("1 && @loop(1)"), "max call depth exceeded")
+}
+
+func TestFunctionGlobals(t *testing.T) {
+	ir := NewInterpreter(false, 2)
+	ass := assert.New(t)
+
+	ass.Equal("", ir.ProcessInstruction("@tax = (x): x * rate"))
+	ass.Equal("error: at index 0: call @tax: unknown variable: rate", ir.ProcessInstruction("@tax(100)"))
+	// errors of nested calls have position of outer call only
+	ass.Equal("", ir.ProcessInstruction("@total = (x): x + @tax(x)"))
+	ass.Equal("error: at index 4: call @total: call @tax: unknown variable: rate", ir.ProcessInstruction("1 + @total(100)"))
+	ass.Equal("", ir.ProcessInstruction(";del @total"))
+	ass.Equal("", ir.ProcessInstruction("rate = 0.2"))
+	ass.Equal("20.00", ir.ProcessInstruction("@tax(100)"))
+	ass.Equal("", ir.ProcessInstruction("rate = 0.1"))
+	ass.Equal("10.00", ir.ProcessInstruction("@tax(100)"))
+
+	// parameters shadow globals
+	ass.Equal("", ir.ProcessInstruction("x = 1000"))
+	ass.Equal("10.00", ir.ProcessInstruction("@tax(100)"))
+
+	ass.Equal("binding: late", ir.ProcessInstruction(";bind"))
+	ass.Equal("", ir.ProcessInstruction(";bind capture"))
+	ass.Equal("binding: capture", ir.ProcessInstruction(";bind"))
+	ass.Equal("", ir.ProcessInstruction("@fixed = (x): x * rate + @tax(x)"))
+	ass.Equal("", ir.ProcessInstruction("rate = 0.5"))
+	ass.Equal("60.00", ir.ProcessInstruction("@fixed(100)"))
+	ass.Equal("error: at index 11: capture: unknown variable: nothing", ir.ProcessInstruction("@bad = (): nothing"))
+
+	ass.Equal("memory:\n"+
+		"rate\t= 0.50\n"+
+		"x\t= 1000.00\n"+
+		"@fixed\t= (x): x * rate + @tax(x)\t[captured: rate = 0.10]\n"+
+		"@tax\t= (x): x * rate\t[uses: rate]\n",
+		ir.ProcessInstruction(";mem"))
+
+	ass.Contains(ir.ProcessInstruction(";bind other"), "unknown binding mode")
+}
@@ -0,0 +1,150 @@
+package gocalc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// names of last result
+const (
+	LastResult      = "ans"
+	LastResultShort = "_"
+)
+
+// DefaultHistoryLimit is used when interpreter has no history limit set
+const DefaultHistoryLimit = 1000
+
+// HistoryEntry is printed result of instruction, it is referenced as _1, _2...
+type HistoryEntry struct {
+	Input string
+	Value Value // nil if value can't be converted to numeric mode of interpreter
+}
+
+// historyName returns name of i-th remembered history entry (from 0)
+func (ir *Interpreter) historyName(i int) string {
+	return fmt.Sprintf("_%d", ir.historyBase+i+1)
+}
+
+// historyIndex returns index of history entry referenced by name (ans, _, _1, _2...)
+func (ir *Interpreter) historyIndex(name string) (int, bool) {
+	if name == LastResult || name == LastResultShort {
+		return len(ir.history) - 1, len(ir.history) > 0
+	}
+	if !isHistoryName(name) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[1:])
+	n -= ir.historyBase
+	if err != nil || n < 1 || n > len(ir.history) {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// isHistoryName reports if name is reserved for history references
+func isHistoryName(name string) bool {
+	if name == LastResult || name == LastResultShort {
+		return true
+	}
+	if len(name) < 2 || name[0] != '_' || name[1] == '0' {
+		return false
+	}
+	for _, c := range name[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// historyValue returns value of history reference
+func (ir *Interpreter) historyValue(name string) (Value, bool) {
+	i, ok := ir.historyIndex(name)
+	if !ok || ir.history[i].Value == nil {
+		return nil, false
+	}
+	return ir.history[i].Value, true
+}
+
+// addHistory remembers printed result of input (continued lines are joined),
+// oldest results over limit are forgotten (references of other results stay the same)
+func (ir *Interpreter) addHistory(input string, val Value) {
+	ir.history = append(ir.history, HistoryEntry{Input: strings.Join(strings.Fields(input), " "), Value: val})
+	ir.trimHistory()
+}
+
+// trimHistory forgets oldest results over history limit
+func (ir *Interpreter) trimHistory() {
+	if n := len(ir.history) - ir.HistoryLimit(); n > 0 {
+		ir.history = append([]HistoryEntry(nil), ir.history[n:]...)
+		ir.historyBase += n
+	}
+}
+
+// HistoryLimit returns number of remembered results
+func (ir *Interpreter) HistoryLimit() int {
+	if ir.historyLimit <= 0 {
+		return DefaultHistoryLimit
+	}
+	return ir.historyLimit
+}
+
+// SetHistoryLimit sets number of remembered results (0 sets DefaultHistoryLimit)
+func (ir *Interpreter) SetHistoryLimit(limit int) {
+	ir.historyLimit = limit
+	ir.trimHistory()
+}
+
+// convertHistory converts values of history to mode of num,
+// values that can't be converted are forgotten (their references stay unknown)
+func (ir *Interpreter) convertHistory(num numeric) {
+	for i := range ir.history {
+		if ir.history[i].Value == nil {
+			continue
+		}
+		val, err := convertValue(num, ir.history[i].Value)
+		if err != nil {
+			val = nil
+		}
+		ir.history[i].Value = val
+	}
+}
+
+// History returns remembered printed results of interactive instructions in order of their references _1, _2...
+// (first of them is not _1 after results over history limit were forgotten)
+func (ir *Interpreter) History() []HistoryEntry {
+	return append([]HistoryEntry(nil), ir.history...)
+}
+
+// ClearHistory forgets all results
+func (ir *Interpreter) ClearHistory() {
+	ir.history = nil
+	ir.historyBase = 0
+}
+
+// historyNames returns names of history references for completion
+func (ir *Interpreter) historyNames() []string {
+	if len(ir.history) == 0 {
+		return nil
+	}
+	names := []string{LastResult, LastResultShort}
+	for i := range ir.history {
+		names = append(names, ir.historyName(i))
+	}
+	return names
+}
+
+// printHistory lists history entries with their inputs
+func (ir *Interpreter) printHistory() string {
+	buf := &strings.Builder{}
+	fmt.Fprintln(buf, "history:")
+	for i, entry := range ir.history {
+		val := "?"
+		if entry.Value != nil {
+			val = ir.Format(entry.Value)
+		}
+		fmt.Fprintf(buf, "%s\t= %s\t[%s]\n", ir.historyName(i), val, entry.Input)
+	}
+	return buf.String()
+}
@@ -0,0 +1,115 @@
+package gocalc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	ass.Equal("error: at index 0: unknown variable: ans", ir.ProcessInstruction("ans"))
+	ass.Equal("history:", ir.ProcessInstruction(";hist"))
+
+	tests := []struct {
+		input, output string
+	}{
+		{"2 + 2", "4.00"},
+		{"ans * 10", "40.00"},
+		{"a = 3", ""},
+		{"_ + a", "43.00"},
+		{"_1 + _2", "44.00"},
+		{"@f = (x): x + ans", ""},
+		{"@f(1)", "45.00"},
+		{";mem", "memory:\na\t= 3.00\n@f\t= (x): x + ans\t[uses: ans]\n"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.input), test.input)
+	}
+
+	ass.Equal("history:\n"+
+		"_1\t= 4.00\t[2 + 2]\n"+
+		"_2\t= 40.00\t[ans * 10]\n"+
+		"_3\t= 43.00\t[_ + a]\n"+
+		"_4\t= 44.00\t[_1 + _2]\n"+
+		"_5\t= 45.00\t[@f(1)]", ir.ProcessInstruction(";hist"))
+	ass.Contains(ir.ProcessInstruction(";mem hist"), "_5\t= 45.00\t[@f(1)]\n")
+	ass.Equal("error: at index 0: unknown variable: _6", ir.ProcessInstruction("_6"))
+	ass.Equal("error: at index 0: ans is history reference", ir.ProcessInstruction("ans = 1"))
+	ass.Equal("error: at index 0: _2 is history reference", ir.ProcessInstruction("_2 := 1"))
+	ass.EqualError(ir.SetVar("_1", 1), "_1 is history reference")
+	ass.Equal("", ir.ProcessInstruction("my_var = 1"))
+	ass.Len(ir.History(), 5)
+
+	ass.Equal([]string{"", "_", "_1", "_2", "_3", "_4", "_5"}, ir.completer("_", "_", 0, 1))
+
+	// values are converted with mode
+	ass.Equal("0.50", ir.ProcessInstruction("0.5"))
+	ass.NoError(ir.SetMode(ModeInt, 0))
+	ass.Equal("44", ir.ProcessInstruction("_4"))
+	ass.Equal("error: at index 0: unknown variable: _6", ir.ProcessInstruction("_6"))
+	ass.Contains(ir.ProcessInstruction(";hist"), "_6\t= ?\t[0.5]")
+
+	ass.Equal("", ir.ProcessInstruction(";hist clear"))
+	ass.Empty(ir.History())
+	ass.Equal("error: at index 0: unknown variable: _", ir.ProcessInstruction("_"))
+}
+
+func TestHistoryCapture(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	ir.SetBinding(BindCapture)
+	ass.Equal("5.00", ir.ProcessInstruction("5"))
+	ass.Equal("", ir.ProcessInstruction("@f = (x): x * ans"))
+	ass.Equal("7.00", ir.ProcessInstruction("7"))
+	ass.Equal("10.00", ir.ProcessInstruction("@f(2)"))
+}
+
+func TestHistoryLimit(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	ass.Equal(DefaultHistoryLimit, ir.HistoryLimit())
+	for _, instr := range []string{"1", "2", "3", "4"} {
+		ass.Equal(instr, ir.ProcessInstruction(instr))
+	}
+
+	// oldest results are forgotten, references of others stay the same
+	ir.SetHistoryLimit(3)
+	ass.Equal(3, ir.HistoryLimit())
+	ass.Equal("5", ir.ProcessInstruction("5"))
+	ass.Equal("history:\n_3\t= 3\t[3]\n_4\t= 4\t[4]\n_5\t= 5\t[5]", ir.ProcessInstruction(";hist"))
+	ass.Equal("error: at index 0: unknown variable: _2", ir.ProcessInstruction("_2"))
+	ass.Equal("12", ir.ProcessInstruction("_3 + _4 + ans"))
+	ass.Equal([]string{"", "_", "_4", "_5", "_6"}, ir.completer("_", "_", 0, 1))
+
+	ir.SetHistoryLimit(1)
+	ass.Equal([]HistoryEntry{{Input: "_3 + _4 + ans", Value: 12.0}}, ir.History())
+	ir.SetHistoryLimit(0)
+	ass.Equal(DefaultHistoryLimit, ir.HistoryLimit())
+
+	ir.ClearHistory()
+	ass.Equal("7", ir.ProcessInstruction("7"))
+	ass.Equal("7", ir.ProcessInstruction("_1"))
+}
+
+func TestHistoryOfAPI(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+
+	// results of API and scripts are not added to history
+	_, err := ir.Exec("1 + 1")
+	ass.NoError(err)
+	_, err = ir.ExecAll("2, 3")
+	ass.NoError(err)
+	_, err = ir.EvalValue("4")
+	ass.NoError(err)
+	ass.NoError(ir.RunScript("", strings.NewReader("5\n"), &strings.Builder{}))
+	_, err = ir.Load(strings.NewReader("6\n"))
+	ass.NoError(err)
+	ass.Empty(ir.History())
+
+	ass.Equal("7\n9", ir.ProcessInstruction("7, a = 8, 9"))
+	ass.Len(ir.History(), 2)
+}
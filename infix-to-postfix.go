@@ -4,81 +4,202 @@ import (
 	"strings"
 )
 
-//opPriority = Supported operators with priority
+// opPriority = Supported operators with priority
+// (xor is ^ of integer modes, bitwise operators are supported only in integer modes,
+// conversion operators to and in are supported only in unit mode,
+// mul is implicit multiplication of unit mode, it binds tighter than * and / (10 km / 2 km),
+// conditional operator ? : has lowest priority and is parsed separately)
 var opPriority = map[string]int{
-	"+":  1,
-	"-":  1,
-	"*":  2,
-	"/":  2,
-	"(":  3,
-	")":  3,
-	"u+": 4,
-	"u-": 4,
+	"to":  0,
+	"in":  0,
+	"||":  1,
+	"&&":  2,
+	"==":  3,
+	"!=":  3,
+	"<":   3,
+	"<=":  3,
+	">":   3,
+	">=":  3,
+	"|":   4,
+	"xor": 5,
+	"&":   6,
+	"<<":  7,
+	">>":  7,
+	"+":   8,
+	"-":   8,
+	"*":   9,
+	"/":   9,
+	"//":  9,
+	"%":   9,
+	"(":   10,
+	"mul": 10,
+	")":   10,
+	"u+":  11,
+	"u-":  11,
+	"u~":  11,
+	"u!":  11,
+	"^":   12,
+	"**":  12,
+}
+
+// rightAssoc = operators grouped from right to left
+var rightAssoc = map[string]bool{
+	"^":  true,
+	"**": true,
+}
+
+// opSymbols are symbols of operators named other way
+var opSymbols = map[string]string{
+	"xor": "^",
+	"mul": "*",
+}
+
+// bitwiseOps are operators of integer modes only
+var bitwiseOps = map[string]bool{
+	"|": true, "xor": true, "&": true, "<<": true, ">>": true, "u~": true,
+}
+
+// conversionOps convert quantity to unit of right operand (60 mph to m/s)
+var conversionOps = map[string]bool{
+	"to": true, "in": true,
+}
+
+// compareOps are comparison operators, their results are 1 (true) or 0 (false)
+var compareOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// logicOps are operators calculated by interpreter in any numeric mode,
+// "ubool" converts value to 1 or 0 (in postfix notation of && and ||)
+var logicOps = map[string]bool{
+	"?": true, ":": true, "&&": true, "||": true, "u!": true, "ubool": true,
+}
+
+// compare reports if comparison op is true for result of Cmp
+func compare(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
 }
 
 func isUnary(tok *Token) bool {
 	return strings.HasPrefix(tok.Operator, "u")
 }
 
-// infixToPostfix converts infix notation to reverse polish notation
-func (ir *Interpreter) infixToPostfix(input []*Token) ([]*Token, error) {
-	output := make([]*Token, 0, len(input))
-	stack := []*Token{}
-	for _, tok := range input {
-		switch tok.Type {
-		case TokenNumber, TokenVariable:
-			output = append(output, tok)
-		case TokenDelimiter:
-			for len(stack) > 0 && stack[len(stack)-1].Operator != "(" {
-				op := stack[len(stack)-1]
-				stack = stack[:len(stack)-1]
-				output = append(output, op)
-			}
-		case TokenOperator, TokenFunction:
-			if tok.Operator == "(" {
-				stack = append(stack, tok)
-				break
-			}
-			if tok.Operator == ")" {
-				op := (*Token)(nil)
-				for len(stack) > 0 {
-					stack, op = stack[:len(stack)-1], stack[len(stack)-1]
-					if op.Operator == "(" {
-						break
-					}
-					output = append(output, op)
-				}
-				if op == nil || op.Operator != "(" {
-					return nil, newIndexedError(tok.Pos, "parens not matching")
-				}
-				if len(stack) > 0 && stack[len(stack)-1].Type == TokenFunction {
-					output = append(output, stack[len(stack)-1])
-					stack = stack[:len(stack)-1]
-				}
-				break
-			}
-			if !isUnary(tok) && tok.Type != TokenFunction {
-				for len(stack) > 0 && stack[len(stack)-1].Operator != "(" &&
-					opPriority[tok.Operator] <= opPriority[stack[len(stack)-1].Operator] {
-
-					op := stack[len(stack)-1]
-					stack = stack[:len(stack)-1]
-					output = append(output, op)
-				}
-			}
-			stack = append(stack, tok)
-		default:
-			return nil, newIndexedError(tok.Pos, "unknown token type")
+// parse builds expression tree with operators of numeric mode of interpreter
+// (^ is bitwise xor in integer modes, ** is power in all modes, to and in convert units in unit mode)
+// and with implicit multiplication if it is on
+func (ir *Interpreter) parse(tokens []*Token) (*Node, error) {
+	return Parse(ir.expandTokens(tokens))
+}
+
+// expandTokens returns tokens with xor of integer modes, conversion operators of unit mode and implicit multiplication
+// (function bodies are stored expanded, so they keep meaning of mode they are declared in)
+func (ir *Interpreter) expandTokens(tokens []*Token) []*Token {
+	if _, ok := ir.num.(*intNumeric); ok {
+		tokens = xorTokens(tokens)
+	}
+	if ir.isUnitMode() {
+		tokens = conversionTokens(tokens)
+	}
+	if op := ir.implicitOp(); op != "" {
+		tokens = implicitTokens(tokens, op)
+	}
+	return tokens
+}
+
+// endsOperand reports if tok can be last token of operand
+func endsOperand(tok *Token) bool {
+	return tok.Type == TokenNumber || tok.Type == TokenVariable || tok.Operator == ")"
+}
+
+// implicitTokens returns tokens with operator op (* or mul) inserted between adjacent operands:
+// 2x, 3(a + b), (a + b)(a - b), 2@f(x)
+// (operand starting with number is not multiplied, so 2 3 stays error),
+// inserted * has priority of * (2x^2 is 2 * x^2, 1/2x is 1 / 2 * x)
+func implicitTokens(tokens []*Token, op string) []*Token {
+	res := make([]*Token, 0, len(tokens))
+	for i, tok := range tokens {
+		if i > 0 && endsOperand(tokens[i-1]) &&
+			(tok.Type == TokenVariable || tok.Type == TokenFunction || tok.Operator == "(") {
+
+			mul := Op(op)
+			mul.Pos, mul.End, mul.Line, mul.Col = tok.Pos, tok.Pos, tok.Line, tok.Col
+			res = append(res, mul)
 		}
+		res = append(res, tok)
 	}
+	return res
+}
+
+// ImplicitMul reports if implicit multiplication is on
+func (ir *Interpreter) ImplicitMul() bool {
+	return ir.implicit
+}
+
+// implicitOp returns operator of implicit multiplication ("" if it is off),
+// it is always on in unit mode and binds tighter there (3 km, 10 km / 2 km)
+func (ir *Interpreter) implicitOp() string {
+	switch {
+	case ir.isUnitMode():
+		return "mul"
+	case ir.implicit:
+		return "*"
+	}
+	return ""
+}
 
-	for i := range stack {
-		op := stack[len(stack)-1-i]
-		if op.Operator == "(" || op.Type == TokenFunction {
-			return nil, newIndexedError(op.Pos, "parens not matching")
+// SetImplicitMul turns implicit multiplication (2x, 3(a + b)) on or off,
+// functions declared with it keep their bodies
+func (ir *Interpreter) SetImplicitMul(on bool) {
+	ir.implicit = on
+}
+
+// xorTokens returns tokens with ^ replaced by xor operator
+func xorTokens(tokens []*Token) []*Token {
+	res := make([]*Token, len(tokens))
+	for i, tok := range tokens {
+		res[i] = tok
+		if tok.Type == TokenOperator && tok.Operator == "^" {
+			xor := *tok
+			xor.Operator = "xor"
+			res[i] = &xor
+		}
+	}
+	return res
+}
+
+// conversionTokens returns tokens with variables to and in after operand replaced by conversion operators
+// (60 mph to m/s), in other places they stay variables
+func conversionTokens(tokens []*Token) []*Token {
+	res := make([]*Token, len(tokens))
+	for i, tok := range tokens {
+		res[i] = tok
+		if i > 0 && tok.Type == TokenVariable && conversionOps[tok.Variable] && endsOperand(tokens[i-1]) {
+			conv := *tok
+			conv.Type, conv.Operator, conv.Variable = TokenOperator, tok.Variable, ""
+			res[i] = &conv
 		}
-		output = append(output, op)
 	}
+	return res
+}
 
-	return output, nil
+// infixToPostfix converts infix notation to reverse polish notation
+// function tokens get argument count of call
+func (ir *Interpreter) infixToPostfix(input []*Token) ([]*Token, error) {
+	tree, err := ir.parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Postfix(), nil
 }
@@ -1,13 +1,14 @@
 package gocalc
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestInfixToPostfix(t *testing.T) {
-	var ir = &Interpreter{}
+	var ir = &Interpreter{num: floatNumeric{}}
 	type test struct {
 		input  []*Token
 		output []*Token
@@ -155,7 +156,7 @@ func TestInfixToPostfix(t *testing.T) {
 				Func("a"), Op("("), Num(2), Op(")"),
 			},
 			output: []*Token{
-				Num(2), Func("a"),
+				Num(2), Call("a", 1),
 			},
 		},
 		{
@@ -163,7 +164,7 @@ func TestInfixToPostfix(t *testing.T) {
 				Func("abc"), Op("("), Num(2), Op("+"), Num(2), Delim(","), UnOp("-"), Num(3), Op(")"),
 			},
 			output: []*Token{
-				Num(2), Num(2), Op("+"), Num(3), UnOp("-"), Func("abc"),
+				Num(2), Num(2), Op("+"), Num(3), UnOp("-"), Call("abc", 2),
 			},
 		},
 		{
@@ -172,7 +173,72 @@ func TestInfixToPostfix(t *testing.T) {
 				UnOp("-"), Num(3), Op("*"), Num(8), Op(")"), Op("+"), Num(22),
 			},
 			output: []*Token{
-				Num(10), Num(2), Num(2), Op("+"), Num(3), UnOp("-"), Num(8), Op("*"), Func("abc"), Op("*"), Num(22), Op("+"),
+				Num(10), Num(2), Num(2), Op("+"), Num(3), UnOp("-"), Num(8), Op("*"), Call("abc", 2), Op("*"), Num(22), Op("+"),
+			},
+		},
+		{
+			input: []*Token{
+				Func("f"), Op("("), Op(")"), Op("+"), Func("g"), Op("("), Op("("), Num(1), Op(")"), Op(")"),
+			},
+			output: []*Token{
+				Call("f", 0), Num(1), Call("g", 1), Op("+"),
+			},
+		},
+		{
+			input: []*Token{
+				Func("max"), Op("("), Num(1), Delim(","), Func("min"), Op("("), Num(2), Delim(","), Num(3), Op(")"),
+				Delim(","), Op("("), Num(4), Op(")"), Op(")"),
+			},
+			output: []*Token{
+				Num(1), Num(2), Num(3), Call("min", 2), Num(4), Call("max", 3),
+			},
+		},
+		{
+			input: []*Token{
+				UnOp("-"), Num(2), Op("^"), Num(2),
+			},
+			output: []*Token{
+				Num(2), Num(2), Op("^"), UnOp("-"),
+			},
+		},
+		{
+			input: []*Token{
+				Num(2), Op("^"), Num(3), Op("^"), Num(2),
+			},
+			output: []*Token{
+				Num(2), Num(3), Num(2), Op("^"), Op("^"),
+			},
+		},
+		{
+			input: []*Token{
+				Num(2), Op("^"), UnOp("-"), Var("x"), Op("*"), Num(3),
+			},
+			output: []*Token{
+				Num(2), Var("x"), UnOp("-"), Op("^"), Num(3), Op("*"),
+			},
+		},
+		{
+			input: []*Token{
+				Op("("), Num(2), Op("^"), Num(3), Op(")"), Op("^"), Num(2),
+			},
+			output: []*Token{
+				Num(2), Num(3), Op("^"), Num(2), Op("^"),
+			},
+		},
+		{
+			input: []*Token{
+				Num(7), Op("%"), Num(4), Op("//"), Num(2), Op("+"), Num(1), Op("*"), Num(3), Op("^"), Num(2),
+			},
+			output: []*Token{
+				Num(7), Num(4), Op("%"), Num(2), Op("//"), Num(1), Num(3), Num(2), Op("^"), Op("*"), Op("+"),
+			},
+		},
+		{
+			input: []*Token{
+				Num(1), Op("-"), Num(7), Op("//"), Num(2), Op("*"), Num(3), Op("%"), Num(5),
+			},
+			output: []*Token{
+				Num(1), Num(7), Num(2), Op("//"), Num(3), Op("*"), Num(5), Op("%"), Op("-"),
 			},
 		},
 	}
@@ -187,7 +253,7 @@ func TestInfixToPostfix(t *testing.T) {
 }
 
 func TestInfixToPostfixErrors(t *testing.T) {
-	var ir = &Interpreter{}
+	var ir = &Interpreter{num: floatNumeric{}}
 	type test struct {
 		input []*Token
 	}
@@ -222,3 +288,50 @@ func TestInfixToPostfixErrors(t *testing.T) {
 	}
 
 }
+
+func TestImplicitInfixToPostfix(t *testing.T) {
+	ass := assert.New(t)
+	ir := &Interpreter{num: floatNumeric{}, implicit: true}
+	tests := []struct {
+		input, output string
+	}{
+		{"2x", "2 x *"},
+		{"2x^2", "2 x 2 ^ *"},
+		{"(2x)^2", "2 x * 2 ^"},
+		{"-2x", "2 - x *"},
+		{"-x^2y", "x 2 ^ - y *"},
+		{"1/2x", "1 2 / x *"},
+		{"1/(2x)", "1 2 x * /"},
+		{"3(a+b)", "3 a b + *"},
+		{"(a+b)(a-b)", "a b + a b - *"},
+		{"2@f(x)", "2 x @f *"},
+		{"2@f(3x, y)z", "2 3 x * y @f * z *"},
+		{"a + 2b * 3c", "a 2 b * 3 * c * +"},
+		{"2x > 3y ? x(y) : 0", "2 x * 3 y * > ? x y * : 0"},
+		{"2 ** 3x", "2 3 ** x *"},
+	}
+	for _, test := range tests {
+		tokens, err := NewStringTokenizer(test.input).Tokens()
+		if !ass.NoError(err, test.input) {
+			continue
+		}
+		postfix, err := ir.infixToPostfix(tokens)
+		if !ass.NoError(err, test.input) {
+			continue
+		}
+		strs := make([]string, len(postfix))
+		for i, tok := range postfix {
+			strs[i] = tok.String()
+		}
+		ass.Equal(test.output, strings.Join(strs, " "), test.input)
+	}
+
+	for _, input := range []string{"2 3", "x 2", "(a)2", "2x 3"} {
+		tokens, _ := NewStringTokenizer(input).Tokens()
+		_, err := ir.infixToPostfix(tokens)
+		ass.Error(err, input)
+	}
+	tokens, _ := NewStringTokenizer("2x").Tokens()
+	_, err := (&Interpreter{num: floatNumeric{}}).infixToPostfix(tokens)
+	ass.EqualError(err, "at index 1: missing operator before x")
+}
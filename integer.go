@@ -0,0 +1,469 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Overflow behaviors of fixed size integer modes
+const (
+	OverflowError = iota // result out of range is an error
+	OverflowWrap         // result wraps around like in two's complement arithmetic
+)
+
+var overflowNames = map[int]string{
+	OverflowError: "error",
+	OverflowWrap:  "wrap",
+}
+
+// integer output bases and prefixes of their literals
+var basePrefixes = map[int]string{
+	2:  "0b",
+	8:  "0o",
+	10: "",
+	16: "0x",
+}
+
+// DefaultIntBits is size of integers of int and uint modes if it is not set
+const DefaultIntBits = 64
+
+var (
+	errOverflow = errors.New("integer overflow")
+	errNotInt   = errors.New("value is not an integer")
+)
+
+// intNumeric is arithmetic of integer modes, values are int64 (int mode), uint64 (uint mode)
+// or *big.Int (bigint mode); operations are calculated with big.Int and fitted to size of mode
+type intNumeric struct {
+	kind     string
+	bits     uint // size of int and uint modes
+	overflow int
+	base     int
+}
+
+func newIntNumeric(kind string, bits uint) (*intNumeric, error) {
+	if kind == ModeBigInt {
+		bits = 0
+	} else if bits == 0 {
+		bits = DefaultIntBits
+	}
+	if bits > 64 {
+		return nil, fmt.Errorf("integer size is too big: %d (max 64)", bits)
+	}
+	if kind == ModeInt && bits < 2 {
+		// 1 is out of range of 1 bit signed integer
+		return nil, fmt.Errorf("integer size is too small: %d (min 2)", bits)
+	}
+	return &intNumeric{kind: kind, bits: bits, base: 10}, nil
+}
+
+func (m *intNumeric) mode() (string, uint) {
+	return m.kind, m.bits
+}
+
+// limits returns range of values of fixed size mode
+func (m *intNumeric) limits() (min, max *big.Int) {
+	one := big.NewInt(1)
+	if m.kind == ModeUint {
+		max = new(big.Int).Lsh(one, m.bits)
+		return big.NewInt(0), max.Sub(max, one)
+	}
+	max = new(big.Int).Lsh(one, m.bits-1)
+	min = new(big.Int).Neg(max)
+	return min, max.Sub(max, one)
+}
+
+// fit converts result to value of mode, results out of range wrap around or fail
+func (m *intNumeric) fit(x *big.Int) (Value, error) {
+	if m.kind == ModeBigInt {
+		if x.BitLen() > maxRatBits {
+			return nil, errTooBig
+		}
+		return x, nil
+	}
+	min, max := m.limits()
+	if x.Cmp(min) < 0 || x.Cmp(max) > 0 {
+		if m.overflow == OverflowError {
+			return nil, errOverflow
+		}
+		x = m.wrap(x)
+	}
+	if m.kind == ModeUint {
+		return x.Uint64(), nil
+	}
+	return x.Int64(), nil
+}
+
+// wrap returns x modulo 2^bits in range of mode
+func (m *intNumeric) wrap(x *big.Int) *big.Int {
+	one := big.NewInt(1)
+	mask := new(big.Int).Lsh(one, m.bits)
+	mask.Sub(mask, one)
+	// And works with two's complement of negative numbers
+	res := new(big.Int).And(x, mask)
+	if m.kind == ModeInt && res.Bit(int(m.bits)-1) == 1 {
+		res.Sub(res, mask).Sub(res, one)
+	}
+	return res
+}
+
+// toBigInt converts integer value of any integer mode to big.Int
+func toBigInt(v Value) *big.Int {
+	switch v := v.(type) {
+	case int64:
+		return big.NewInt(v)
+	case uint64:
+		return new(big.Int).SetUint64(v)
+	case *big.Int:
+		return v
+	}
+	return nil
+}
+
+func (m *intNumeric) number(tok *Token) (Value, error) {
+	if tok.Imag {
+		return nil, errImag
+	}
+	if tok.Literal == "" {
+		return m.convert(tok.Number)
+	}
+	lit := strings.ReplaceAll(tok.Literal, "_", "")
+	base := 0
+	if len(lit) > 1 && lit[0] == '0' && lit[1] >= '0' && lit[1] <= '9' {
+		// leading zero is not octal prefix like in float mode
+		base = 10
+	}
+	x, ok := new(big.Int).SetString(lit, base)
+	if !ok {
+		// 1e3 and 2.0 are integers too
+		r, err := (&ratNumeric{}).number(tok)
+		if err != nil {
+			return nil, err
+		}
+		if !r.(*big.Rat).IsInt() {
+			return nil, fmt.Errorf("%s is not an integer", tok.Literal)
+		}
+		x = r.(*big.Rat).Num()
+	}
+	return m.fit(x)
+}
+
+func (m *intNumeric) convert(v Value) (Value, error) {
+	switch v := v.(type) {
+	case int64, uint64:
+		return m.fit(toBigInt(v))
+	case *big.Int:
+		return m.fit(new(big.Int).Set(v))
+	case *big.Rat:
+		if !v.IsInt() {
+			return nil, errNotInt
+		}
+		return m.fit(new(big.Int).Set(v.Num()))
+	case *big.Float:
+		if v.IsInf() {
+			return nil, errInf
+		}
+		if !v.IsInt() {
+			return nil, errNotInt
+		}
+		x, _ := v.Int(nil)
+		return m.fit(x)
+	case complex128:
+		if imag(v) != 0 {
+			return nil, errNotReal
+		}
+		return m.convert(real(v))
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return nil, errNaN
+		case math.IsInf(v, 0):
+			return nil, errInf
+		case v != math.Trunc(v):
+			return nil, errNotInt
+		}
+		x, _ := big.NewFloat(v).Int(nil)
+		return m.fit(x)
+	}
+	return nil, fmt.Errorf("can't convert %v", v)
+}
+
+func (m *intNumeric) float(v Value) float64 {
+	return toFloat64(v)
+}
+
+func (m *intNumeric) truth(v Value) bool {
+	return toBigInt(v).Sign() != 0
+}
+
+// constant returns nothing, constants are not integers
+func (m *intNumeric) constant(name string) (Value, bool) {
+	return nil, false
+}
+
+func (m *intNumeric) unary(op string, a Value) (Value, error) {
+	x := toBigInt(a)
+	switch op {
+	case "u+":
+		return a, nil
+	case "u-":
+		return m.fit(new(big.Int).Neg(x))
+	case "u~":
+		z := new(big.Int).Not(x)
+		if m.kind == ModeUint {
+			// complement of unsigned number never overflows
+			z = m.wrap(z)
+		}
+		return m.fit(z)
+	}
+	return nil, opError(op)
+}
+
+func (m *intNumeric) binary(op string, a, b Value) (Value, error) {
+	x, y := toBigInt(a), toBigInt(b)
+	z := new(big.Int)
+	switch op {
+	case "+":
+		return m.fit(z.Add(x, y))
+	case "-":
+		return m.fit(z.Sub(x, y))
+	case "*":
+		return m.fit(z.Mul(x, y))
+	case "&":
+		return m.fit(z.And(x, y))
+	case "|":
+		return m.fit(z.Or(x, y))
+	case "xor":
+		return m.fit(z.Xor(x, y))
+	case "<<", ">>":
+		return m.shift(op, x, y)
+	case "==", "!=", "<", "<=", ">", ">=":
+		return m.fit(z.SetInt64(int64(boolFloat(compare(op, x.Cmp(y))))))
+	case "**", "^":
+		return m.pow(x, y)
+	}
+	if y.Sign() == 0 {
+		return nil, errDivZero
+	}
+	switch op {
+	case "/":
+		// truncated like in go
+		return m.fit(z.Quo(x, y))
+	case "//":
+		q, _ := floorDivMod(x, y)
+		return m.fit(q)
+	case "%":
+		_, r := floorDivMod(x, y)
+		return m.fit(r)
+	}
+	return nil, opError(op)
+}
+
+// floorDivMod returns quotient rounded down and remainder with sign of y
+func floorDivMod(x, y *big.Int) (q, r *big.Int) {
+	q, r = new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() != 0 && r.Sign() != y.Sign() {
+		q.Sub(q, big.NewInt(1))
+		r.Add(r, y)
+	}
+	return q, r
+}
+
+// shift shifts x by y bits (arithmetic shift for negative numbers)
+func (m *intNumeric) shift(op string, x, y *big.Int) (Value, error) {
+	if y.Sign() < 0 {
+		return nil, errors.New("negative shift count")
+	}
+	n := uint(maxRatBits + 1)
+	if y.IsUint64() && y.Uint64() < uint64(n) {
+		n = uint(y.Uint64())
+	}
+	if op == ">>" {
+		return m.fit(new(big.Int).Rsh(x, n))
+	}
+	switch {
+	case x.Sign() == 0:
+		return m.fit(x)
+	case n > maxRatBits && m.kind == ModeBigInt:
+		return nil, errTooBig
+	case n > maxRatBits && m.overflow == OverflowWrap:
+		// all bits are shifted out
+		return m.fit(new(big.Int))
+	case n > maxRatBits:
+		return nil, errOverflow
+	}
+	return m.fit(new(big.Int).Lsh(x, n))
+}
+
+// pow calculates x^y for non negative y
+func (m *intNumeric) pow(x, y *big.Int) (Value, error) {
+	if y.Sign() < 0 {
+		return nil, errors.New("negative exponent")
+	}
+	if m.kind != ModeBigInt && m.overflow == OverflowWrap {
+		mod := new(big.Int).Lsh(big.NewInt(1), m.bits)
+		return m.fit(new(big.Int).Exp(x, y, mod))
+	}
+	// size of result is checked before calculation
+	limit := int64(maxRatBits)
+	if m.kind != ModeBigInt {
+		limit = int64(m.bits)
+	}
+	if bits := int64(x.BitLen() - 1); bits > 0 && (!y.IsInt64() || y.Int64() > limit/bits) {
+		if m.kind == ModeBigInt {
+			return nil, errTooBig
+		}
+		return nil, errOverflow
+	}
+	return m.fit(new(big.Int).Exp(x, y, nil))
+}
+
+func (m *intNumeric) call(name string, args []Value) (Value, error) {
+	xs := make([]*big.Int, len(args))
+	for i, arg := range args {
+		xs[i] = toBigInt(arg)
+	}
+	x := xs[0]
+	switch name {
+	case "abs":
+		return m.fit(new(big.Int).Abs(x))
+	case "sign":
+		return m.fit(big.NewInt(int64(x.Sign())))
+	case "min", "max":
+		res := x
+		for _, y := range xs[1:] {
+			if cmp := y.Cmp(res); (name == "min" && cmp < 0) || (name == "max" && cmp > 0) {
+				res = y
+			}
+		}
+		return m.fit(res)
+	case "floor", "ceil", "round", "trunc", "re", "conj":
+		return args[0], nil
+	case "im":
+		return m.fit(new(big.Int))
+	case "sqrt":
+		// integer square root (rounded down)
+		if x.Sign() < 0 {
+			return nil, errNaN
+		}
+		return m.fit(new(big.Int).Sqrt(x))
+	}
+	return nil, fmt.Errorf("@%s is not supported in integer mode", name)
+}
+
+func (m *intNumeric) format(v Value, precision int) string {
+	x := toBigInt(v)
+	prefix := basePrefixes[m.base]
+	if x.Sign() < 0 {
+		return "-" + prefix + new(big.Int).Abs(x).Text(m.base)
+	}
+	return prefix + x.Text(m.base)
+}
+
+func (m *intNumeric) literal(v Value) string {
+	x := toBigInt(v)
+	if m.kind == ModeInt {
+		// minimal value has no positive pair
+		if min, _ := m.limits(); x.Cmp(min) == 0 {
+			return fmt.Sprintf("-%s - 1", new(big.Int).Sub(new(big.Int).Neg(x), big.NewInt(1)))
+		}
+	}
+	return x.String()
+}
+
+func (m *intNumeric) warnings() []string {
+	return nil
+}
+
+// bitsLayout shows binary representation of value (two's complement for negative integers)
+func (m *intNumeric) bitsLayout(v Value) string {
+	x := toBigInt(v)
+	width := int(m.bits)
+	if m.kind == ModeBigInt {
+		// whole bytes with room for sign bit
+		width = (x.BitLen()/8 + 1) * 8
+	}
+	if x.Sign() < 0 {
+		x = new(big.Int).Add(x, new(big.Int).Lsh(big.NewInt(1), uint(width)))
+	}
+	digits := fmt.Sprintf("%0*s", width, x.Text(2))
+	return groupBits(digits)
+}
+
+// groupBits splits binary digits to bytes, 4 bytes per line labeled with bit numbers
+func groupBits(digits string) string {
+	bytes := []string{}
+	for end := len(digits); end > 0; end -= 8 {
+		bytes = append([]string{digits[maxInt(0, end-8):end]}, bytes...)
+	}
+	lines := []string{}
+	labels := []string{}
+	for end := len(bytes); end > 0; end -= 4 {
+		start := maxInt(0, end-4)
+		low := (len(bytes) - end) * 8
+		high := len(digits) - 1 - start*8
+		if start > 0 {
+			high = low + 4*8 - 1
+		}
+		labels = append([]string{fmt.Sprintf("%d-%d:", high, low)}, labels...)
+		lines = append([]string{strings.Join(bytes[start:end], " ")}, lines...)
+	}
+	width := 0
+	for _, label := range labels {
+		width = maxInt(width, len(label))
+	}
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%-*s %s", width, labels[i], lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// floatBitsLayout shows parts of float64 value
+func floatBitsLayout(f float64) string {
+	bits := fmt.Sprintf("%064b", math.Float64bits(f))
+	return fmt.Sprintf("sign:     %s\nexponent: %s\nmantissa: %s", bits[:1], bits[1:12], bits[12:])
+}
+
+// Bits returns binary layout of last result (integer and float modes only)
+func (ir *Interpreter) Bits() (string, error) {
+	if ir.last == nil {
+		return "", errors.New("no result yet")
+	}
+	switch m := ir.num.(type) {
+	case *intNumeric:
+		return m.bitsLayout(ir.last), nil
+	case floatNumeric:
+		return floatBitsLayout(ir.last.(float64)), nil
+	}
+	mode, _ := ir.Mode()
+	return "", fmt.Errorf("no binary layout in %s mode", mode)
+}
+
+// Base returns base of integers in output of integer modes
+func (ir *Interpreter) Base() int {
+	return ir.base
+}
+
+// SetBase sets base of integers in output of integer modes (2, 8, 10 or 16)
+func (ir *Interpreter) SetBase(base int) error {
+	if _, ok := basePrefixes[base]; !ok {
+		return fmt.Errorf("unsupported base %d (use 2, 8, 10 or 16)", base)
+	}
+	ir.base = base
+	ir.num = ir.configure(ir.num)
+	return nil
+}
+
+// Overflow returns overflow behavior of int and uint modes
+func (ir *Interpreter) Overflow() int {
+	return ir.overflow
+}
+
+// SetOverflow sets overflow behavior of int and uint modes (OverflowError, OverflowWrap)
+func (ir *Interpreter) SetOverflow(overflow int) {
+	ir.overflow = overflow
+	ir.num = ir.configure(ir.num)
+}
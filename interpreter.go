@@ -1,7 +1,6 @@
 package gocalc
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -13,33 +12,178 @@ import (
 
 // Interpreter interprets calculator commands
 type Interpreter struct {
-	vars        map[string]float64
-	funcs       map[string]*function
-	interactive bool
-	precision   int
-	prevLine    *string
+	vars         map[string]Value
+	num          numeric // arithmetic of numeric mode
+	funcs        map[string]*function
+	interactive  bool
+	precision    int
+	maxDepth     int
+	binding      int
+	fracStyle    int
+	numFormat    int   // format of numbers in float, big and complex modes
+	implicit     bool  // implicit multiplication (2x)
+	base         int   // base of output in integer modes
+	overflow     int   // overflow behavior of int and uint modes
+	last         Value // last result (for ;bits)
+	history      []HistoryEntry
+	historyBase  int // number of forgotten oldest results
+	historyLimit int
+	commands     map[string]*Command // commands registered by embedder
+	done         bool                // ;quit was executed
+	initFile     string
+	loading      map[string]bool // files being executed (see enterFile)
+	prevLine     *string
 }
 
-type indexedError struct {
-	index int
-	msg   string
+// Error is an error that knows position of problem in input
+type Error struct {
+	Pos int // position in input (byte offset, see Column for display column)
+	End int // position after problem in input (not greater than Pos if only Pos is known)
+	Msg string
 }
 
-func newIndexedError(index int, msg string, args ...interface{}) indexedError {
-	return indexedError{index, fmt.Sprintf(msg, args...)}
+func newError(pos int, msg string, args ...interface{}) *Error {
+	return spanError(pos, pos, msg, args...)
 }
 
-func (ie indexedError) Error() string {
-	return fmt.Sprintf("at index %d: %s", ie.index, ie.msg)
+// spanError creates error for input from pos to end
+func spanError(pos, end int, msg string, args ...interface{}) *Error {
+	return &Error{pos, end, fmt.Sprintf(msg, args...)}
+}
+
+// tokenError creates error for input of tok
+func tokenError(tok *Token, msg string, args ...interface{}) *Error {
+	return spanError(tok.Pos, tok.End, msg, args...)
+}
+
+// tokensError creates error for input of all tokens
+func tokensError(tokens []*Token, msg string, args ...interface{}) *Error {
+	if len(tokens) == 0 {
+		return newError(0, msg, args...)
+	}
+	pos, end := tokens[0].Pos, tokens[0].End
+	for _, tok := range tokens[1:] {
+		pos = minInt(pos, tok.Pos)
+		end = maxInt(end, tok.End)
+	}
+	return spanError(pos, end, msg, args...)
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("at index %d: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of errors found in one input
+type ErrorList []*Error
+
+// add appends error, errors repeated at same position are skipped
+func (l *ErrorList) add(err *Error) {
+	for _, e := range *l {
+		if e.Pos == err.Pos && e.Msg == err.Msg {
+			return
+		}
+	}
+	*l = append(*l, err)
+}
+
+// addAll appends errors of err (*Error or ErrorList)
+func (l *ErrorList) addAll(err error) {
+	switch err := err.(type) {
+	case *Error:
+		l.add(err)
+	case ErrorList:
+		for _, e := range err {
+			l.add(e)
+		}
+	}
+}
+
+// sort sorts errors by position in input
+func (l ErrorList) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Pos < l[j].Pos
+	})
+}
+
+// Err returns nil for empty list, single error or list itself
+func (l ErrorList) Err() error {
+	switch len(l) {
+	case 0:
+		return nil
+	case 1:
+		return l[0]
+	}
+	return l
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// As makes errors.As find first error of list as *Error
+func (l ErrorList) As(target interface{}) bool {
+	if perr, ok := target.(**Error); ok && len(l) > 0 {
+		*perr = l[0]
+		return true
+	}
+	return false
+}
+
+// Errors returns errors of err: all errors of ErrorList or err itself
+func Errors(err error) []error {
+	if l, ok := err.(ErrorList); ok {
+		res := make([]error, len(l))
+		for i, e := range l {
+			res[i] = e
+		}
+		return res
+	}
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
+
+// Col returns byte column of error in line (starting from 1)
+func (e *Error) Col() int {
+	return e.Pos + 1
+}
+
+// Column returns display column of error in line of input (starting from 1)
+func (e *Error) Column(input string) int {
+	return displayWidth(input[:minInt(e.Pos, len(input))]) + 1
+}
+
+// Caret returns input with marker under span of error in next line, like
+//
+//	2 + (3
+//	    ^
+//
+// marker is aligned by display columns, so it stays under problem in input with any characters
+func (e *Error) Caret(input string) string {
+	pos := minInt(e.Pos, len(input))
+	width := 1
+	if e.End > pos {
+		width = maxInt(displayWidth(input[pos:minInt(e.End, len(input))]), 1)
+	}
+	return fmt.Sprintf("%s\n%s^%s", input, strings.Repeat(" ", e.Column(input)-1), strings.Repeat("~", width-1))
 }
 
 // NewInterpreter from input to output
 func NewInterpreter(verbose bool, precision int) *Interpreter {
 	return &Interpreter{
-		vars:        map[string]float64{},
+		vars:        map[string]Value{},
+		num:         floatNumeric{},
 		funcs:       map[string]*function{},
 		interactive: verbose,
 		precision:   precision,
+		base:        10,
 	}
 }
 
@@ -53,9 +197,30 @@ func (ir *Interpreter) completer(input, line string, start, end int) []string {
 		k = "@" + k
 		names = append(names, k)
 	}
+	for k := range builtins {
+		if _, ok := ir.funcs[k]; !ok {
+			names = append(names, "@"+k)
+		}
+	}
 	for k := range ir.vars {
 		names = append(names, k)
 	}
+	for _, k := range ir.constantNames() {
+		if _, ok := ir.vars[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	if ir.isUnitMode() {
+		for _, k := range Units() {
+			if _, ok := ir.vars[k]; !ok {
+				names = append(names, k)
+			}
+		}
+	}
+	names = append(names, ir.historyNames()...)
+	for _, k := range ir.Commands() {
+		names = append(names, ";"+k)
+	}
 
 	res := []string{}
 	for _, name := range names {
@@ -93,91 +258,108 @@ func (ir *Interpreter) Start(input io.Reader, output io.Writer) error {
 					fmt.Fprintln(output, res)
 				}
 				ir.prevLine = line
+				if ir.done {
+					return nil
+				}
 			}
 		}
 	} else {
-		scn := bufio.NewScanner(input)
-		for scn.Scan() {
-			if res := ir.ProcessInstruction(scn.Text()); res != "" {
-				fmt.Fprintln(output, res)
-			}
-		}
-		return scn.Err()
+		return ir.runScript("", input, output, true)
 	}
 }
 
-func (ir *Interpreter) printError(err error) string {
-	return fmt.Sprintf("error: %v", err)
+// printError prints error of instruction from input
+// interactive mode shows input with marker under position of error
+// all errors of list are printed, each in its own line
+func (ir *Interpreter) printError(input string, err error) string {
+	lines := []string{}
+	for _, err := range Errors(err) {
+		var perr *Error
+		if ir.interactive && errors.As(err, &perr) {
+			lines = append(lines, fmt.Sprintf("error: %s\n%s", perr.Msg, perr.Caret(input)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("error: %v", err))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (ir *Interpreter) printPrompt() string {
 	return "eval> "
 }
 
-func (ir *Interpreter) printResult(res float64) string {
+func (ir *Interpreter) printCaptured(fn *function) string {
+	vals := []string{}
+	for _, name := range fn.globals() {
+		if val, ok := fn.captured[name]; ok {
+			vals = append(vals, fmt.Sprintf("%s = %s", name, ir.Format(val)))
+		}
+	}
+	return strings.Join(vals, ", ")
+}
+
+func (ir *Interpreter) printResult(res Value) string {
 	if ir.interactive {
-		return fmt.Sprintf("= %.*f", ir.precision, res)
+		return "= " + ir.Format(res)
 	}
-	return fmt.Sprintf("%.*f", ir.precision, res)
+	return ir.Format(res)
 }
 
-// ProcessMetaCommand processes meta command
-func (ir *Interpreter) ProcessMetaCommand(token *Token) (string, error) {
-	if token.Type != TokenMetaCommand {
-		return "", fmt.Errorf("not a meta command")
+// printVars lists variables with their values
+func (ir *Interpreter) printVars(buf *strings.Builder) {
+	for _, k := range ir.Vars() {
+		fmt.Fprintf(buf, "%s\t= %s\n", k, ir.Format(ir.vars[k]))
 	}
-	switch token.Command {
-	case "mem":
-		buf := &strings.Builder{}
-		fmt.Fprintln(buf, "memory:")
-		for k, v := range ir.vars {
-			fmt.Fprintf(buf, "%s\t= %.*f\n", k, ir.precision, v)
+}
+
+// printFuncs lists functions with globals they use, optimized or as declared
+func (ir *Interpreter) printFuncs(buf *strings.Builder, original bool) {
+	for _, k := range ir.Funcs() {
+		fn := ir.funcs[k]
+		if original {
+			fmt.Fprintf(buf, "@%s\t= %s", k, fn)
+		} else {
+			fmt.Fprintf(buf, "@%s\t= %s", k, fn.optimizedString(ir))
 		}
-		for k, v := range ir.funcs {
-			fmt.Fprintf(buf, "@%s\t= %s\n", k, v)
+		if globals := fn.globals(); len(globals) > 0 {
+			if fn.captured != nil {
+				fmt.Fprintf(buf, "\t[captured: %s]", ir.printCaptured(fn))
+			} else {
+				fmt.Fprintf(buf, "\t[uses: %s]", strings.Join(globals, ", "))
+			}
 		}
-		return buf.String(), nil
-	default:
-		return "", newIndexedError(token.Pos, "unknown meta command ;%s", token.Command)
+		fmt.Fprintln(buf)
 	}
-
 }
 
 // ProcessInstruction processes instruction
+// (several instructions separated by commas are processed one by one till error)
+// values of expressions are added to history
 func (ir *Interpreter) ProcessInstruction(input string) string {
-	tokenizer := NewStringTokenizer(input)
-	tokens, err := tokenizer.Tokens()
-	if err != nil {
-		return ir.printError(err)
-	}
-	if len(tokens) == 0 {
-		return ""
-	}
-	if tokens[0].Type == TokenMetaCommand {
-		res, err := ir.ProcessMetaCommand(tokens[0])
-		if err != nil {
-			return ir.printError(err)
-		}
-		return res
-	}
-	if len(tokens) >= 2 && tokens[1].Operator == "=" {
-		var err error
-		switch tokens[0].Type {
-		case TokenVariable:
-			err = ir.processAssignment(tokens)
-		case TokenFunction:
-			err = ir.processFunctionDeclaration(tokens)
-		default:
-			err = errors.New("invalid assignment")
-		}
-		if err != nil {
-			return ir.printError(err)
+	tokens, err := NewStringTokenizer(input).Tokens()
+	results, err := ir.execAll(input, tokens, err, true)
+	lines := []string{}
+	for _, res := range results {
+		if out := ir.printExecResult(res); out != "" {
+			lines = append(lines, out)
 		}
-		return ""
 	}
-	res, err := ir.calculateExpression(tokens)
 	if err != nil {
-		return ir.printError(err)
+		lines = append(lines, ir.printError(input, err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ir *Interpreter) printExecResult(res *Result) string {
+	lines := []string{}
+	for _, w := range res.Warnings {
+		lines = append(lines, "warning: "+w)
+	}
+	switch res.Kind {
+	case ResultValue:
+		lines = append(lines, ir.printResult(res.Number))
+	case ResultCommand:
+		lines = append(lines, res.Output)
 	}
-	return ir.printResult(res)
+	return strings.Join(lines, "\n")
 }
@@ -1,5 +1,13 @@
 package gocalc
 
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 // func TestInterpreter(t *testing.T) {
 // 	ass := assert.New(t)
 // 	input := "2 + 2\n" +
@@ -20,3 +28,82 @@ package gocalc
 
 // 	ass.Equal(expected, buf.String())
 // }
+
+func TestErrorCaret(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal("2 + (3\n    ^", newError(4, "parens not matching").Caret("2 + (3"))
+	ass.Equal("1 + foo\n    ^~~", spanError(4, 7, "unknown variable: foo").Caret("1 + foo"))
+
+	ir := NewInterpreter(true, 2)
+	ass.Equal("error: unknown variable: foo\n1 + foo\n    ^~~", ir.ProcessInstruction("1 + foo"))
+	ass.Equal("error: missing operator before 3\n2 3\n  ^", ir.ProcessInstruction("2 3"))
+	ass.Equal("error: no init file", ir.ProcessInstruction(";reload"))
+	ass.Equal("error: bad token\n2 * $y\n    ^\nerror: unknown variable: y\n2 * $y\n     ^",
+		ir.ProcessInstruction("2 * $y"))
+}
+
+func TestErrorSpans(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	ir.SetBinding(BindCapture)
+	tests := []struct {
+		input    string
+		pos, end int
+	}{
+		{"pi = 3", 0, 2},
+		{"2 = 3", 0, 1},
+		{"x =", 3, 3},
+		{"@sqrt = (x): x", 0, 5},
+		{"@f = (x y): x", 5, 10},
+		{"@f = (x) x", 9, 10},
+		{"@f = (x)", 8, 8},
+		{"@f = (x): x + yy", 14, 16},
+		{"1 + @nothing(2)", 4, 12},
+		{"@sqrt(1, 2)", 0, 5},
+		{";unknown 1 2", 0, 12},
+	}
+	for _, test := range tests {
+		_, err := ir.Exec(test.input)
+		var perr *Error
+		if ass.True(errors.As(err, &perr), test.input) {
+			ass.Equal(test.pos, perr.Pos, test.input)
+			ass.Equal(test.end, perr.End, test.input)
+		}
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	tests := []struct {
+		input, output string
+	}{
+		{"α = 2", ""},
+		{"Δt = 0.5", ""},
+		{"@vitesse_é = (d, Δt): d / Δt", ""},
+		{"@vitesse_é(α, Δt)", "4.00"},
+		{"π", "3.14"},
+		{"2 * φ", "3.24"},
+		{"π = 3", "error: at index 0: π is constant (use := to override)"},
+		{"αβ + 1", "error: at index 0: unknown variable: αβ"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.input), test.input)
+	}
+	ass.Contains(ir.ProcessInstruction(";builtins"), "π\t= 3.14\n")
+
+	// markers are aligned by display columns
+	ir = NewInterpreter(true, 2)
+	ass.Equal("", ir.ProcessInstruction("α = 1"))
+	ass.Equal("error: unknown variable: ωω\nα + ωω\n    ^~", ir.ProcessInstruction("α + ωω"))
+	ass.Equal("error: unknown variable: 日本\n日本 + y\n^~~~\nerror: unknown variable: y\n日本 + y\n       ^",
+		ir.ProcessInstruction("日本 + y"))
+
+	err := &Error{Pos: 5, End: 7, Msg: "unknown variable: y"}
+	ass.Equal(6, err.Col())
+	ass.Equal(4, err.Column("αβ + y"))
+
+	buf := &strings.Builder{}
+	ass.NoError(NewInterpreter(false, 2).RunScript("test.calc", strings.NewReader("température + x\n"), buf))
+	ass.Equal("test.calc:1:1: error: unknown variable: température\ntest.calc:1:15: error: unknown variable: x\n", buf.String())
+}
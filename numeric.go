@@ -0,0 +1,317 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Value is a number of numeric mode: float64 in float mode, *big.Float in big mode,
+// *big.Rat in rat mode, complex128 in complex mode, int64, uint64 or *big.Int in integer modes,
+// Quantity in unit mode
+type Value interface{}
+
+// Numeric modes
+const (
+	ModeFloat   = "float"
+	ModeBig     = "big"
+	ModeRat     = "rat"
+	ModeComplex = "complex"
+	ModeInt     = "int"
+	ModeUint    = "uint"
+	ModeBigInt  = "bigint"
+	ModeUnit    = "unit"
+)
+
+// DefaultBigPrecision is mantissa precision (bits) of big mode if it is not set
+const DefaultBigPrecision = 256
+
+var errNaN = errors.New("result is not a number")
+
+// numeric is arithmetic of numeric mode
+type numeric interface {
+	// mode returns name of mode and its precision (0 if mode has no precision)
+	mode() (string, uint)
+	// number converts number token to value, literal is parsed exactly if mode can do it
+	number(tok *Token) (Value, error)
+	// convert converts value of any mode to value of this mode
+	convert(v Value) (Value, error)
+	float(v Value) float64
+	// truth reports if value is true (not zero)
+	truth(v Value) bool
+	constant(name string) (Value, bool)
+	unary(op string, a Value) (Value, error)
+	binary(op string, a, b Value) (Value, error)
+	// call calls builtin function, argument count is already checked
+	call(name string, args []Value) (Value, error)
+	// format formats value for output with precision digits after point
+	format(v Value, precision int) string
+	// literal formats value as expression that gives exactly same value
+	literal(v Value) string
+	// warnings returns and forgets warnings about inexact calculations
+	warnings() []string
+}
+
+// newNumeric creates arithmetic of mode, zero precision is default precision of mode
+func newNumeric(mode string, prec uint) (numeric, error) {
+	switch mode {
+	case ModeFloat:
+		return floatNumeric{}, nil
+	case ModeBig:
+		if prec == 0 {
+			prec = DefaultBigPrecision
+		}
+		if prec > big.MaxPrec {
+			return nil, fmt.Errorf("precision is too big: %d", prec)
+		}
+		return newBigNumeric(prec), nil
+	case ModeRat:
+		return &ratNumeric{}, nil
+	case ModeComplex:
+		return complexNumeric{}, nil
+	case ModeInt, ModeUint, ModeBigInt:
+		return newIntNumeric(mode, prec)
+	case ModeUnit:
+		return unitNumeric{}, nil
+	}
+	return nil, fmt.Errorf("unknown mode %s", mode)
+}
+
+// opError reports operator that numeric mode does not support
+func opError(op string) error {
+	if bitwiseOps[op] {
+		return fmt.Errorf("%s needs integer mode", &Token{Type: TokenOperator, Operator: op})
+	}
+	if conversionOps[op] {
+		return fmt.Errorf("%s needs unit mode", op)
+	}
+	return fmt.Errorf("unknown operator %s", op)
+}
+
+// boolFloat returns 1 for true and 0 for false
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// boolValue returns 1 for true and 0 for false in numeric mode of interpreter
+func (ir *Interpreter) boolValue(b bool) Value {
+	v, _ := ir.num.convert(boolFloat(b))
+	return v
+}
+
+// toFloat64 converts value of any mode to float64 (NaN if value is not real)
+func toFloat64(v Value) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case complex128:
+		if imag(v) != 0 {
+			return math.NaN()
+		}
+		return real(v)
+	case *big.Float:
+		f, _ := v.Float64()
+		return f
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case Quantity:
+		if !v.dimensionless() {
+			return math.NaN()
+		}
+		return v.Num
+	}
+	return math.NaN()
+}
+
+// convertValue converts value of any mode to mode of num,
+// quantity with dimension can't leave unit mode
+func convertValue(num numeric, v Value) (Value, error) {
+	if _, ok := num.(unitNumeric); ok {
+		return num.convert(v)
+	}
+	if q, ok := v.(Quantity); ok {
+		if !q.dimensionless() {
+			return nil, fmt.Errorf("value has unit %s", q.unitName())
+		}
+		v = q.Num
+	}
+	return num.convert(v)
+}
+
+// floatNumeric is arithmetic of float mode, values are float64
+type floatNumeric struct {
+	style int // format of output
+}
+
+func (floatNumeric) mode() (string, uint) {
+	return ModeFloat, 0
+}
+
+func (floatNumeric) number(tok *Token) (Value, error) {
+	if tok.Imag {
+		return nil, errImag
+	}
+	return tok.Number, nil
+}
+
+func (floatNumeric) convert(v Value) (Value, error) {
+	if z, ok := v.(complex128); ok && imag(z) != 0 {
+		return nil, errNotReal
+	}
+	return toFloat64(v), nil
+}
+
+func (floatNumeric) float(v Value) float64 {
+	return v.(float64)
+}
+
+func (floatNumeric) truth(v Value) bool {
+	return v.(float64) != 0
+}
+
+func (floatNumeric) constant(name string) (Value, bool) {
+	val, ok := constants[name]
+	return val, ok
+}
+
+func (floatNumeric) unary(op string, a Value) (Value, error) {
+	switch op {
+	case "u+":
+		return a, nil
+	case "u-":
+		return -a.(float64), nil
+	}
+	return nil, opError(op)
+}
+
+func (floatNumeric) binary(op string, a, b Value) (Value, error) {
+	res, ok := applyOperator(op, a.(float64), b.(float64))
+	if !ok {
+		return nil, opError(op)
+	}
+	return res, nil
+}
+
+func (floatNumeric) call(name string, args []Value) (Value, error) {
+	floats := make([]float64, len(args))
+	for i, arg := range args {
+		floats[i] = arg.(float64)
+	}
+	return builtins[name].fn(floats), nil
+}
+
+func (m floatNumeric) format(v Value, precision int) string {
+	return formatFloat(v.(float64), m.style, precision)
+}
+
+func (floatNumeric) literal(v Value) string {
+	return formatLiteral(v.(float64))
+}
+
+func (floatNumeric) warnings() []string {
+	return nil
+}
+
+// Mode returns numeric mode of interpreter and its precision
+func (ir *Interpreter) Mode() (string, uint) {
+	return ir.num.mode()
+}
+
+// SetMode sets numeric mode (ModeFloat, ModeBig, ModeRat, ModeComplex, ModeInt, ModeUint, ModeBigInt, ModeUnit)
+// with precision (0 for default, size in bits for int and uint modes),
+// values of variables are converted to new mode
+func (ir *Interpreter) SetMode(mode string, prec uint) error {
+	num, err := newNumeric(mode, prec)
+	if err != nil {
+		return err
+	}
+	// nothing is changed if some value can't be converted
+	vars, err := convertAll(num, ir.vars)
+	if err != nil {
+		return err
+	}
+	captured := map[string]map[string]Value{}
+	for name, fn := range ir.funcs {
+		if captured[name], err = convertAll(num, fn.captured); err != nil {
+			return fmt.Errorf("@%s: %v", name, err)
+		}
+	}
+
+	ir.num = ir.configure(num)
+	ir.vars = vars
+	if ir.last != nil {
+		// last result is forgotten if it can't be converted
+		ir.last, _ = convertValue(num, ir.last)
+	}
+	ir.convertHistory(num)
+	for name, fn := range ir.funcs {
+		fn.captured = captured[name]
+		// optimized body depends on mode
+		fn.reset()
+	}
+	return nil
+}
+
+// configure applies output settings of interpreter to num and returns it
+func (ir *Interpreter) configure(num numeric) numeric {
+	switch m := num.(type) {
+	case floatNumeric:
+		m.style = ir.numFormat
+		return m
+	case complexNumeric:
+		m.style = ir.numFormat
+		return m
+	case unitNumeric:
+		m.style = ir.numFormat
+		return m
+	case *bigNumeric:
+		m.style = ir.numFormat
+	case *ratNumeric:
+		m.style = ir.fracStyle
+	case *intNumeric:
+		m.base, m.overflow = ir.base, ir.overflow
+	}
+	return num
+}
+
+// convertAll converts values of variables to mode of num
+func convertAll(num numeric, vals map[string]Value) (map[string]Value, error) {
+	if vals == nil {
+		return nil, nil
+	}
+	res := make(map[string]Value, len(vals))
+	for name, val := range vals {
+		conv, err := convertValue(num, val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		res[name] = conv
+	}
+	return res, nil
+}
+
+// modeString describes numeric mode of interpreter
+func (ir *Interpreter) modeString() string {
+	mode, prec := ir.Mode()
+	if prec == 0 {
+		return mode
+	}
+	return fmt.Sprintf("%s %d", mode, prec)
+}
+
+// Format formats value of numeric mode of interpreter with precision of interpreter
+func (ir *Interpreter) Format(v Value) string {
+	return ir.num.format(v, ir.precision)
+}
@@ -0,0 +1,474 @@
+package gocalc
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBigMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 40)
+	ass.NoError(ir.SetMode(ModeBig, 0))
+	tests := []struct {
+		expr, output string
+	}{
+		{"2 ^ 64 + 1", "18446744073709551617.0000000000000000000000000000000000000000"},
+		{"0.1 * 3", "0.3000000000000000000000000000000000000000"},
+		{"1 / 3", "0.3333333333333333333333333333333333333333"},
+		{"pi", "3.1415926535897932384626433832795028841972"},
+		{"e", "2.7182818284590452353602874713526624977572"},
+		{"phi", "1.6180339887498948482045868343656381177203"},
+		{"@sqrt(2)", "1.4142135623730950488016887242096980785697"},
+		{"@ln(2)", "0.6931471805599453094172321214581765680755"},
+		{"@exp(-1) * e", "1.0000000000000000000000000000000000000000"},
+		{"@sin(pi / 6)", "0.5000000000000000000000000000000000000000"},
+		{"@atan(1) * 4", "3.1415926535897932384626433832795028841972"},
+		{"@acos(-1)", "3.1415926535897932384626433832795028841972"},
+		{"@tanh(0.5)", "0.4621171572600097585023184836436725487303"},
+		{"@log(1024, 2)", "10.0000000000000000000000000000000000000000"},
+		{"2 ^ 0.5", "1.4142135623730950488016887242096980785697"},
+		{"-7 // 2", "-4.0000000000000000000000000000000000000000"},
+		{"-7 % 3", "2.0000000000000000000000000000000000000000"},
+		{"@round(-2.5) + @ceil(0.1) + @min(3, -1, 2)", "-3.0000000000000000000000000000000000000000"},
+		{"0x10 + 0b11 * 0o10 - 1_000", "-960.0000000000000000000000000000000000000000"},
+		{"1 / 0", "+Inf"},
+		{"2 ^ -1e9", "0.0000000000000000000000000000000000000000"},
+		{"2 ^ 65535 > 0", "1.0000000000000000000000000000000000000000"},
+	}
+	for _, test := range tests {
+		res, err := ir.EvalValue(test.expr)
+		if ass.NoError(err, test.expr) {
+			ass.Equal(test.output, ir.Format(res), test.expr)
+		}
+	}
+
+	for _, expr := range []string{"0 / 0", "(-8) ^ (1 / 3)", "@sqrt(-1)", "@ln(-1)", "@asin(2)"} {
+		_, err := ir.Eval(expr)
+		if ass.Error(err, expr) {
+			ass.Contains(err.Error(), "result is not a number", expr)
+		}
+	}
+
+	// results too big to be formatted are rejected
+	for _, expr := range []string{"2 ^ 1e9", "2 ^ 1e5", "1.5 ^ 1e9", "0.5 ^ -1e9", "2 ^ 100000.5", "@exp(1e9)", "(2 ^ 6e4) ^ 2", "1e1000000"} {
+		_, err := ir.Eval(expr)
+		if ass.Error(err, expr) {
+			ass.Contains(err.Error(), "result is too big", expr)
+		}
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 20)
+	ass.Equal("mode: float", ir.ProcessInstruction(";mode"))
+	ass.Equal("", ir.ProcessInstruction("a = 1 / 3"))
+	ass.Equal("", ir.ProcessInstruction("@f = (x): x * 2 + 0.1"))
+
+	ass.Equal("", ir.ProcessInstruction(";mode big 128"))
+	ass.Equal("mode: big 128", ir.ProcessInstruction(";mode"))
+	mode, prec := ir.Mode()
+	ass.Equal(ModeBig, mode)
+	ass.EqualValues(128, prec)
+
+	// values are converted exactly
+	val, ok := ir.GetValue("a")
+	if ass.True(ok) {
+		ass.Equal("0.33333333333333331483", ir.Format(val))
+	}
+	ass.Equal("0.30000000000000000000", ir.ProcessInstruction("@f(0.1)"))
+	res, err := ir.Exec("b = 2 ^ 100")
+	if ass.NoError(err) {
+		ass.IsType(&big.Float{}, res.Number)
+		ass.Equal(1267650600228229401496703205376.0, res.Value)
+	}
+
+	ass.Equal("", ir.ProcessInstruction(";mode float"))
+	ass.Equal("0.30000000000000004441", ir.ProcessInstruction("@f(0.1)"))
+	ass.Equal("error: at index 0: unknown mode fixed", ir.ProcessInstruction(";mode fixed"))
+	ass.Equal("error: at index 0: bad precision x", ir.ProcessInstruction(";mode big x"))
+
+	ass.NoError(ir.SetVar("nan", 0))
+	ir.vars["nan"] = 0.0 / zero()
+	ass.Error(ir.SetMode(ModeBig, 0))
+	mode, _ = ir.Mode()
+	ass.Equal(ModeFloat, mode)
+}
+
+// zero prevents constant division by zero
+func zero() float64 {
+	return 0
+}
+
+func TestBigSaveLoad(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 50)
+	for _, instr := range []string{
+		";mode big 200",
+		";bind capture",
+		"a = 1 / 3",
+		"b = 2 ^ 80 + 1",
+		"@f = (x): x + a",
+	} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	ass.True(strings.HasPrefix(buf.String(), ";mode big 200\n"), buf.String())
+
+	loaded := NewInterpreter(false, 50)
+	report, err := loaded.Load(strings.NewReader(buf.String()))
+	ass.NoError(err)
+	ass.Empty(report.Errors)
+	for _, expr := range []string{"a", "b", "@f(1)"} {
+		exp, err := ir.EvalValue(expr)
+		ass.NoError(err)
+		act, err := loaded.EvalValue(expr)
+		ass.NoError(err)
+		ass.Equal(ir.Format(exp), loaded.Format(act), expr)
+	}
+}
+
+func TestRatMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 4)
+	ass.NoError(ir.SetMode(ModeRat, 0))
+	tests := []struct {
+		expr, output string
+	}{
+		{"1/3 + 1/6", "1/2"},
+		{"0.1 * 3", "3/10"},
+		{"1.5e-3", "3/2000"},
+		{"0x10 / 0b110", "8/3"},
+		{"2 ^ 100", "1267650600228229401496703205376"},
+		{"(2/3) ^ -2", "9/4"},
+		{"-7 // 2", "-4"},
+		{"-7 % 3", "2"},
+		{"7.5 % 2", "3/2"},
+		{"@sqrt(9/4) + @hypot(3, 4)", "13/2"},
+		{"@round(-5/2) + @ceil(-3/2) + @floor(1/2) + @trunc(-3/2)", "-5"},
+		{"@max(1/2, 2/3, 3/5)", "2/3"},
+	}
+	for _, test := range tests {
+		res, err := ir.Exec(test.expr)
+		if ass.NoError(err, test.expr) {
+			ass.Equal(test.output, ir.Format(res.Number), test.expr)
+			ass.Empty(res.Warnings, test.expr)
+		}
+	}
+
+	for expr, msg := range map[string]string{
+		"1 / 0":         "division by zero",
+		"0 ^ -1":        "division by zero",
+		"5 % 0":         "division by zero",
+		"10 ^ 10000000": "result is too big",
+		"(-8) ^ 0.5":    "result is not a number",
+	} {
+		_, err := ir.Eval(expr)
+		if ass.Error(err, expr) {
+			ass.Contains(err.Error(), msg, expr)
+		}
+	}
+}
+
+func TestRatWarnings(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(true, 4)
+	ass.Equal("", ir.ProcessInstruction(";mode rat"))
+	res, err := ir.Exec("@sin(1) + pi + @sin(2)")
+	if ass.NoError(err) {
+		ass.Equal([]string{"pi is approximated with float64", "@sin is calculated with float64"}, res.Warnings)
+		ass.InDelta(4.8924, res.Value, 1e-4)
+	}
+	ass.Equal("warning: @sqrt is calculated with float64\n= 6369051672525773/4503599627370496",
+		ir.ProcessInstruction("@sqrt(2)"))
+	ass.Equal("warning: power with fractional exponent is calculated with float64",
+		ir.ProcessInstruction("a = 2 ^ 0.5"))
+	ass.Equal("= 2", ir.ProcessInstruction("@sqrt(4)"))
+}
+
+func TestFracStyle(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 3)
+	ass.Equal("fractions: fraction", ir.ProcessInstruction(";frac"))
+	ass.Equal("", ir.ProcessInstruction(";frac mixed"))
+	ass.Equal(FracMixed, ir.FracStyle())
+	ass.Equal("", ir.ProcessInstruction(";mode rat"))
+
+	tests := []struct {
+		style            int
+		a, b, c, integer string
+	}{
+		{FracFraction, "7/2", "-7/2", "1/3", "4"},
+		{FracMixed, "3 1/2", "-3 1/2", "1/3", "4"},
+		{FracDecimal, "3.500", "-3.500", "0.333", "4.000"},
+	}
+	for _, test := range tests {
+		ir.SetFracStyle(test.style)
+		ass.Equal(test.a, ir.ProcessInstruction("7/2"))
+		ass.Equal(test.b, ir.ProcessInstruction("-7/2"))
+		ass.Equal(test.c, ir.ProcessInstruction("1/3"))
+		ass.Equal(test.integer, ir.ProcessInstruction("8/2"))
+	}
+	ass.Equal("error: at index 0: unknown style of fractions bad", ir.ProcessInstruction(";frac bad"))
+}
+
+func TestRatSaveLoad(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	for _, instr := range []string{
+		";mode rat",
+		";bind capture",
+		"a = -1/3",
+		"b = 2 ^ 80 + 1/7",
+		"@f = (x): x + a",
+	} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	ass.Equal(";mode rat\n"+
+		"a = -1/3\n"+
+		"b = 8462480737302404222943233/7\n"+
+		"@f = (x): x + (-1 / 3)\n", buf.String())
+
+	loaded := NewInterpreter(false, 2)
+	report, err := loaded.Load(strings.NewReader(buf.String()))
+	ass.NoError(err)
+	ass.Empty(report.Errors)
+	ass.Equal("2/3", loaded.ProcessInstruction("@f(1)"))
+}
+
+func TestComplexMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 3)
+	ass.Equal("error: at index 0: imaginary number needs complex mode", ir.ProcessInstruction("4i"))
+	ass.NoError(ir.SetMode(ModeComplex, 0))
+	tests := []struct {
+		expr, output string
+	}{
+		{"3+4i", "3.000+4.000i"},
+		{"(3+4i) * (1-2i)", "11.000-2.000i"},
+		{"@sqrt(-1)", "1.000i"},
+		{"@sqrt(-4) * i", "-2.000"},
+		{"i ^ 2", "-1.000"},
+		{"(1+i) ^ 8", "16.000"},
+		{"@abs(3+4i)", "5.000"},
+		{"@arg(i) * 2", "3.142"},
+		{"@re(3+4i) + @im(3+4i)", "7.000"},
+		{"@conj(3+4i)", "3.000-4.000i"},
+		{"@polar(2, pi / 2)", "2.000i"},
+		{"@exp(i * pi)", "-1.000"},
+		{"@ln(-1)", "3.142i"},
+		{"(-8) ^ (1/3)", "1.000+1.732i"},
+		{"@sign(3+4i)", "0.600+0.800i"},
+		{"@sin(1) + 2 ^ 0.5", "2.256"},
+		{"-7 // 2 + 1 / 0", "+Inf"},
+		{"i * i == -1", "1.000"},
+		{"1 + i != 1 ? 2 : 3", "2.000"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.expr), test.expr)
+	}
+
+	ass.Equal("error: at index 5: division by zero", ir.ProcessInstruction("(1+i)/0"))
+	ass.Equal("error: at index 2: % needs real operands", ir.ProcessInstruction("5 % i"))
+	ass.Equal("error: at index 2: < needs real operands", ir.ProcessInstruction("i < 1"))
+	ass.Equal("error: at index 0: call @max: @max needs real arguments", ir.ProcessInstruction("@max(1, i)"))
+	ass.Equal("error: at index 0: i is constant (use := to override)", ir.ProcessInstruction("i = 2"))
+
+	res, err := ir.Exec("z = 1 - 2i")
+	if ass.NoError(err) {
+		ass.Equal(1-2i, res.Number)
+		ass.True(math.IsNaN(res.Value))
+	}
+	ass.EqualError(ir.SetMode(ModeFloat, 0), "z: value is not real")
+	ass.Equal("", ir.ProcessInstruction("z = @re(z)"))
+	ass.NoError(ir.SetMode(ModeFloat, 0))
+	ass.Equal("1.000", ir.ProcessInstruction("z"))
+	ass.Equal("2.000", ir.ProcessInstruction("@polar(2, 0)"))
+	ass.Equal("3.142", ir.ProcessInstruction("@arg(-1)"))
+}
+
+func TestComplexSaveLoad(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	for _, instr := range []string{
+		";mode complex",
+		";bind capture",
+		"a = 0.5 - 2i",
+		"b = 3i",
+		"@f = (x): x * a",
+	} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	ass.Equal(";mode complex\n"+
+		"a = 0.5 - 2i\n"+
+		"b = 3i\n"+
+		"@f = (x): x * (0.5 - 2i)\n", buf.String())
+
+	loaded := NewInterpreter(false, 2)
+	report, err := loaded.Load(strings.NewReader(buf.String()))
+	ass.NoError(err)
+	ass.Empty(report.Errors)
+	ass.Equal("6.00+1.50i", loaded.ProcessInstruction("@f(b)"))
+}
+
+func TestIntMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 3)
+	ass.Equal("error: at index 2: & needs integer mode", ir.ProcessInstruction("6 & 3"))
+	ass.Equal("8.000", ir.ProcessInstruction("2 ^ 3"))
+	ass.NoError(ir.SetMode(ModeInt, 0))
+	ass.Equal("mode: int 64", ir.ProcessInstruction(";mode"))
+	tests := []struct {
+		expr, output string
+	}{
+		{"7 / 2", "3"},
+		{"-7 / 2", "-3"},
+		{"-7 // 2", "-4"},
+		{"-7 % 3", "2"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"2 ** 10", "1024"},
+		{"~5", "-6"},
+		{"1 << 10 >> 3", "128"},
+		{"-16 >> 2", "-4"},
+		{"1 | 6 ^ 3 & 5", "7"},
+		{"1 + 2 << 3", "24"},
+		{"0xFF & 0b1010", "10"},
+		{"010 + 1e3", "1010"},
+		{"@abs(-5) + @max(1, 9, 3) + @sqrt(17)", "18"},
+		{"9223372036854775807", "9223372036854775807"},
+		{"7 > 2 && 7 & 1 == 1", "1"},
+		{"-1 < 0 ? 5 : 6", "5"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.expr), test.expr)
+	}
+
+	ass.Equal("error: at index 20: integer overflow", ir.ProcessInstruction("9223372036854775807 + 1"))
+	ass.Equal("error: at index 2: division by zero", ir.ProcessInstruction("1 / 0"))
+	ass.Equal("error: at index 0: 1.5 is not an integer", ir.ProcessInstruction("1.5"))
+	ass.Equal("error: at index 2: negative shift count", ir.ProcessInstruction("1 << -1"))
+	ass.Equal("error: at index 2: negative exponent", ir.ProcessInstruction("2 ** -1"))
+	ass.Equal("error: at index 0: call @sin: @sin is not supported in integer mode", ir.ProcessInstruction("@sin(1)"))
+	ass.Equal("error: at index 0: unknown variable: pi", ir.ProcessInstruction("pi"))
+
+	ass.Equal("", ir.ProcessInstruction(";overflow wrap"))
+	ass.Equal("overflow: wrap", ir.ProcessInstruction(";overflow"))
+	ass.Equal("-9223372036854775808", ir.ProcessInstruction("9223372036854775807 + 1"))
+	ass.Equal("-1", ir.ProcessInstruction("0xFFFF_FFFF_FFFF_FFFF"))
+	ass.Equal("0", ir.ProcessInstruction("2 ** 64"))
+	ass.Equal("0", ir.ProcessInstruction("1 << 100"))
+	ass.Equal("-3", ir.ProcessInstruction("3 ** 41 * 0 - 3"))
+
+	ass.NoError(ir.SetMode(ModeUint, 8))
+	ass.Equal("250", ir.ProcessInstruction("~5"))
+	ass.Equal("255", ir.ProcessInstruction("0 - 1"))
+	ir.SetOverflow(OverflowError)
+	ass.Equal("error: at index 2: integer overflow", ir.ProcessInstruction("0 - 1"))
+	ass.Equal("error: at index 0: integer size is too big: 128 (max 64)", ir.ProcessInstruction(";mode int 128"))
+
+	ass.NoError(ir.SetMode(ModeBigInt, 0))
+	ass.Equal("1267650600228229401496703205376", ir.ProcessInstruction("2 ** 100"))
+	ass.Equal("-1267650600228229401496703205376", ir.ProcessInstruction("-1 << 100"))
+	ass.Equal("error: at index 2: result is too big", ir.ProcessInstruction("2 ** 10000000"))
+}
+
+func TestIntConvert(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 3)
+	ass.Equal("", ir.ProcessInstruction("a = 2.5"))
+	ass.EqualError(ir.SetMode(ModeInt, 0), "a: value is not an integer")
+	ass.Equal("", ir.ProcessInstruction("a = 1e30"))
+	ass.EqualError(ir.SetMode(ModeInt, 0), "a: integer overflow")
+	ass.NoError(ir.SetMode(ModeBigInt, 0))
+	ass.Equal("1000000000000000019884624838656", ir.ProcessInstruction("a"))
+	ass.Equal("", ir.ProcessInstruction("b = a + 1"))
+	ass.NoError(ir.SetMode(ModeRat, 0))
+	ass.Equal("1000000000000000019884624838657", ir.ProcessInstruction("b"))
+	ass.NoError(ir.SetMode(ModeFloat, 0))
+	ass.Equal("1000000000000000019884624838656.000", ir.ProcessInstruction("b"))
+
+	// ^ of function body keeps meaning of mode it is declared in
+	ass.Equal("", ir.ProcessInstruction("@pow = (x, y): x ^ y"))
+	ass.NoError(ir.SetMode(ModeBigInt, 0))
+	ass.Equal("", ir.ProcessInstruction("@xor = (x, y): x ^ y"))
+	ass.Equal("125", ir.ProcessInstruction("@pow(5, 3)"))
+	ass.Equal("6", ir.ProcessInstruction("@xor(5, 3)"))
+	ass.NoError(ir.SetMode(ModeFloat, 0))
+	ass.Equal("125.000", ir.ProcessInstruction("@pow(5, 3)"))
+	ass.Equal("error: at index 0: call @xor: ^ needs integer mode", ir.ProcessInstruction("@xor(5, 3)"))
+}
+
+func TestIntOutput(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 3)
+	ass.Equal("error: at index 0: no result yet", ir.ProcessInstruction(";bits"))
+	ass.Equal("-2.000", ir.ProcessInstruction("-2"))
+	ass.Equal("sign:     1\n"+
+		"exponent: 10000000000\n"+
+		"mantissa: 0000000000000000000000000000000000000000000000000000", ir.ProcessInstruction(";bits"))
+
+	ass.NoError(ir.SetMode(ModeInt, 0))
+	ass.Equal("", ir.ProcessInstruction(";base 16"))
+	ass.Equal("base: 16", ir.ProcessInstruction(";base"))
+	ass.Equal("0xff", ir.ProcessInstruction("255"))
+	ass.Equal("-0x10", ir.ProcessInstruction("-16"))
+	ass.Equal("63-32: 11111111 11111111 11111111 11111111\n"+
+		"31-0:  11111111 11111111 11111111 11110000", ir.ProcessInstruction(";bits"))
+	ass.NoError(ir.SetBase(2))
+	ass.Equal("", ir.ProcessInstruction("x = 5"))
+	ass.Equal("0b101", ir.ProcessInstruction("x"))
+	ass.Equal("error: at index 0: unsupported base 3 (use 2, 8, 10 or 16)", ir.ProcessInstruction(";base 3"))
+
+	ass.NoError(ir.SetMode(ModeUint, 12))
+	ass.Equal("0b101", ir.ProcessInstruction("x"))
+	ass.Equal("11-0: 0000 00000101", ir.ProcessInstruction(";bits"))
+
+	ass.NoError(ir.SetMode(ModeBigInt, 0))
+	ass.NoError(ir.SetBase(8))
+	ass.Equal("-0o400", ir.ProcessInstruction("-256"))
+	ass.Equal("15-0: 11111111 00000000", ir.ProcessInstruction(";bits"))
+
+	ass.NoError(ir.SetMode(ModeRat, 0))
+	ass.Equal("error: at index 0: no binary layout in rat mode", ir.ProcessInstruction(";bits"))
+}
+
+func TestIntSaveLoad(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	for _, instr := range []string{
+		";mode int",
+		";bind capture",
+		"a = -9223372036854775807 - 1",
+		"b = 0x10",
+		"@f = (x): x ^ b + a",
+	} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	ass.Equal(";mode int 64\n"+
+		"a = -9223372036854775807 - 1\n"+
+		"b = 16\n"+
+		"@f = (x): x ^ 16 + (-9223372036854775807 - 1)\n", buf.String())
+
+	loaded := NewInterpreter(false, 2)
+	report, err := loaded.Load(strings.NewReader(buf.String()))
+	ass.NoError(err)
+	ass.Empty(report.Errors)
+	ass.Equal("-9223372036854775791", loaded.ProcessInstruction("@f(1)"))
+}
@@ -0,0 +1,228 @@
+package gocalc
+
+import (
+	"math"
+)
+
+func (n *Node) isNumber(val float64) bool {
+	return n.Kind == NodeNumber && n.Tok.Number == val
+}
+
+// numberNode returns number node in place of node at
+func numberNode(at *Node, val float64) *Node {
+	return &Node{Kind: NodeNumber, Tok: &Token{Type: TokenNumber, Pos: at.Pos, Number: val}, Pos: at.Pos, End: at.End}
+}
+
+// opNodeAt returns operator node in place of node at
+func opNodeAt(at *Node, op string, args ...*Node) *Node {
+	n := opNode(&Token{Type: TokenOperator, Pos: at.Tok.Pos, End: at.Tok.End, Operator: op}, args...)
+	n.Pos, n.End = at.Pos, at.End
+	return n
+}
+
+// negate returns tree of -n in place of node at
+func negate(at *Node, n *Node) *Node {
+	switch {
+	case n.Kind == NodeNumber:
+		return numberNode(at, -n.Tok.Number)
+	case n.Tok.Operator == "u-":
+		return n.Args[0]
+	}
+	return opNodeAt(at, "u-", n)
+}
+
+// optimize simplifies tree, value of expression stays the same:
+// constant subexpressions are calculated, identities like x * 1 are removed
+// calls and variables are never folded, because they are resolved at call time
+func optimize(n *Node) *Node {
+	if len(n.Args) == 0 {
+		return n
+	}
+	args := make([]*Node, len(n.Args))
+	constant := true
+	for i := range n.Args {
+		args[i] = optimize(n.Args[i])
+		constant = constant && args[i].Kind == NodeNumber
+	}
+	n = n.withArgs(args)
+	switch {
+	case n.Kind == NodeCall:
+		return n
+	case n.Kind == NodeCond && args[0].Kind == NodeNumber:
+		// only one branch can be calculated
+		if args[0].Tok.Number != 0 {
+			return args[1]
+		}
+		return args[2]
+	case n.Kind == NodeCond:
+		return n
+	}
+	if constant {
+		if folded, ok := fold(n); ok {
+			return folded
+		}
+	}
+	return simplify(n)
+}
+
+// fold calculates operator with number operands
+// results that can't be printed as number (inf, nan) are not folded,
+// operators of other modes (~) are not folded, so they are reported when calculated
+func fold(n *Node) (*Node, bool) {
+	var res float64
+	if len(n.Args) == 1 {
+		res = n.Args[0].Tok.Number
+		switch n.Tok.Operator {
+		case "u+":
+		case "u-":
+			res = -res
+		case "u!":
+			res = boolFloat(res == 0)
+		default:
+			return nil, false
+		}
+	} else {
+		var ok bool
+		res, ok = applyOperator(n.Tok.Operator, n.Args[0].Tok.Number, n.Args[1].Tok.Number)
+		if !ok {
+			return nil, false
+		}
+	}
+	if math.IsInf(res, 0) || math.IsNaN(res) {
+		return nil, false
+	}
+	return numberNode(n, res), true
+}
+
+// simplify removes identities from operator with optimized operands
+func simplify(n *Node) *Node {
+	if len(n.Args) == 1 {
+		switch n.Tok.Operator {
+		case "u+":
+			return n.Args[0]
+		case "u-":
+			return negate(n, n.Args[0])
+		}
+		return n
+	}
+
+	a, b := n.Args[0], n.Args[1]
+	switch n.Tok.Operator {
+	case "+":
+		switch {
+		case b.isNumber(0):
+			return a
+		case a.isNumber(0):
+			return b
+		case b.Tok.Operator == "u-":
+			return opNodeAt(n, "-", a, b.Args[0])
+		}
+	case "-":
+		switch {
+		case b.isNumber(0):
+			return a
+		case a.isNumber(0):
+			return negate(n, b)
+		case b.Tok.Operator == "u-":
+			return opNodeAt(n, "+", a, b.Args[0])
+		}
+	case "*":
+		switch {
+		case b.isNumber(1):
+			return a
+		case a.isNumber(1):
+			return b
+		case b.isNumber(-1):
+			return negate(n, a)
+		case a.isNumber(-1):
+			return negate(n, b)
+		case a.Tok.Operator == "u-" && b.Tok.Operator == "u-":
+			return n.withArgs([]*Node{a.Args[0], b.Args[0]})
+		}
+	case "/":
+		switch {
+		case b.isNumber(1):
+			return a
+		case b.isNumber(-1):
+			return negate(n, a)
+		case a.Tok.Operator == "u-" && b.Tok.Operator == "u-":
+			return n.withArgs([]*Node{a.Args[0], b.Args[0]})
+		}
+	case "^", "**":
+		switch {
+		case b.isNumber(1):
+			return a
+		case b.isNumber(0):
+			return numberNode(n, 1)
+		}
+	}
+	return n
+}
+
+// minCommonSize is size of smallest subexpression worth calculating once
+const minCommonSize = 3
+
+// extractCommon replaces subexpressions repeated in tree with variables $1, $2...
+// and returns their trees, each of them can use only variables before it
+// (subexpression is extracted only if it's always calculated somewhere, not only in branches of ? : && ||)
+func extractCommon(root *Node) (*Node, []*Node) {
+	trees := []*Node{root}
+	for {
+		counts := map[string]int{}
+		sizes := map[string]int{}
+		eager := map[string]bool{}
+		for _, tree := range trees {
+			countSubtrees(tree, true, counts, sizes, eager)
+		}
+		// smallest first, so later subexpressions use earlier ones
+		best := ""
+		for key, cnt := range counts {
+			if cnt < 2 || !eager[key] {
+				continue
+			}
+			if best == "" || sizes[key] < sizes[best] || sizes[key] == sizes[best] && key < best {
+				best = key
+			}
+		}
+		if best == "" {
+			break
+		}
+
+		name := letName(len(trees) - 1)
+		var common *Node
+		for i := range trees {
+			trees[i] = replaceSubtree(trees[i], best, name, &common)
+		}
+		trees = append(trees, common)
+	}
+
+	return trees[0], trees[1:]
+}
+
+// countSubtrees counts subexpressions of n, isEager is false inside of branches
+func countSubtrees(n *Node, isEager bool, counts, sizes map[string]int, eager map[string]bool) {
+	if size := n.size(); size >= minCommonSize {
+		key := n.key()
+		counts[key]++
+		sizes[key] = size
+		eager[key] = eager[key] || isEager
+	}
+	for i, arg := range n.Args {
+		countSubtrees(arg, isEager && i < len(n.eagerArgs()), counts, sizes, eager)
+	}
+}
+
+func replaceSubtree(n *Node, key, name string, replaced **Node) *Node {
+	if n.size() < minCommonSize {
+		return n
+	}
+	if n.key() == key {
+		*replaced = n
+		return &Node{Kind: NodeVariable, Tok: &Token{Type: TokenVariable, Pos: n.Pos, Variable: name}, Pos: n.Pos, End: n.End}
+	}
+	args := make([]*Node, len(n.Args))
+	for i := range n.Args {
+		args[i] = replaceSubtree(n.Args[i], key, name, replaced)
+	}
+	return n.withArgs(args)
+}
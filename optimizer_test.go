@@ -0,0 +1,133 @@
+package gocalc
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimize(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	tests := []struct {
+		body, optimized string
+	}{
+		{"2 * 3 * x", "6 * x"},
+		{"x * 2 * 3", "x * 2 * 3"},
+		{"x * (2 * 3)", "x * 6"},
+		{"x * 1 + 0", "x"},
+		{"1 * x / 1 - 0", "x"},
+		{"0 + x ^ 1", "x"},
+		{"x ^ (2 - 2)", "1"},
+		{"--x", "x"},
+		{"-+-+x", "x"},
+		{"x * -1", "-x"},
+		{"-1 * -x", "x"},
+		{"-x * -y", "x * y"},
+		{"x - -y", "x + y"},
+		{"x + -y", "x - y"},
+		{"0 - (x + y)", "-(x + y)"},
+		{"(((x)))", "x"},
+		{"((x * y)) + ((2))", "x * y + 2"},
+		{"(x - y) - (x - (y - 1))", "x - y - (x - (y - 1))"},
+		{"(x ^ y) ^ 2 + x ^ (y ^ 2)", "(x ^ y) ^ 2 + x ^ y ^ 2"},
+		{"(-x) ^ 2 + -(x ^ 2)", "(-x) ^ 2 - x ^ 2"},
+		{"-(2 + 3) ^ x", "-5 ^ x"},
+		{"(-(2 + 3)) ^ x", "(-5) ^ x"},
+		{"x * (0 - 2)", "x * -2"},
+		{"@sqrt(4) * (2 + 2)", "@sqrt(4) * 4"},
+		{"1 / 0 + x", "1 / 0 + x"},
+		{"(x + y) * (x + y)", "$1 * $1 where $1 = x + y"},
+		{"@f(x * y, 2) + @f(x * y, 2) / (x * y)", "$2 + $2 / $1 where $1 = x * y, $2 = @f($1, 2)"},
+		{"-x + -x", "-x - x"},
+		{"x > 0 ? 2 * 3 : y", "x > 0 ? 6 : y"},
+		{"1 < 2 ? x : y", "x"},
+		{"!(2 > 3) * x", "x"},
+		{"x > 0 ? (x + y) * (x + y) : 0", "x > 0 ? (x + y) * (x + y) : 0"},
+		{"x && (x + y) * (x + y)", "x && (x + y) * (x + y)"},
+		{"(x + y) > 0 ? x + y : 0", "$1 > 0 ? $1 : 0 where $1 = x + y"},
+		{"~5 + x", "~5 + x"},
+	}
+
+	for _, test := range tests {
+		ass.Equal("", ir.ProcessInstruction("@f = (x, y): "+test.body))
+		ass.Equal("(x, y): "+test.optimized, ir.funcs["f"].optimizedString(ir), test.body)
+		ass.Equal("(x, y): "+test.body, ir.funcs["f"].String(), test.body)
+	}
+
+	// operator of other mode is reported when optimized body is calculated
+	ass.Equal("", ir.ProcessInstruction("@g = (x): ~5 + x"))
+	ass.Equal("error: at index 0: call @g: ~ needs integer mode", ir.ProcessInstruction("@g(1)"))
+}
+
+func TestOptimizeMem(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	ir.ProcessInstruction("@f = (x): 2 * 3 * x * k")
+	ass.Equal("memory:\n@f\t= (x): 6 * x * k\t[uses: k]\n", ir.ProcessInstruction(";mem"))
+	ass.Equal("memory:\n@f\t= (x): 2 * 3 * x * k\t[uses: k]\n", ir.ProcessInstruction(";mem orig"))
+}
+
+// randomExpr generates random expression with variables x, y
+func randomExpr(rnd *rand.Rand, depth int) string {
+	if depth == 0 || rnd.Intn(4) == 0 {
+		switch rnd.Intn(5) {
+		case 0:
+			return "x"
+		case 1:
+			return "y"
+		}
+		return []string{"0", "1", "2", "0.5", "3"}[rnd.Intn(5)]
+	}
+	switch rnd.Intn(6) {
+	case 0:
+		return []string{"-", "+"}[rnd.Intn(2)] + randomExpr(rnd, depth-1)
+	case 1:
+		return "(" + randomExpr(rnd, depth-1) + ")"
+	case 2:
+		return "@max(" + randomExpr(rnd, depth-1) + ", " + randomExpr(rnd, depth-1) + ")"
+	case 3:
+		// repeated subexpression
+		sub := randomExpr(rnd, depth-1)
+		return "(" + sub + ") * (" + sub + ")"
+	}
+	op := []string{"+", "-", "*", "/", "^", "%", "//"}[rnd.Intn(7)]
+	return randomExpr(rnd, depth-1) + " " + op + " " + randomExpr(rnd, depth-1)
+}
+
+func TestOptimizeRandom(t *testing.T) {
+	ass := assert.New(t)
+	rnd := rand.New(rand.NewSource(1))
+	ir := NewInterpreter(false, 2)
+	for i := 0; i < 2000; i++ {
+		expr := randomExpr(rnd, 5)
+		ass.Equal("", ir.ProcessInstruction("@f = (x, y): "+expr))
+		tokens, err := NewStringTokenizer(expr).Tokens()
+		ass.NoError(err)
+		for j := 0; j < 5; j++ {
+			x, y := rnd.NormFloat64()*3, float64(rnd.Intn(7)-3)
+			ir.vars["x"], ir.vars["y"] = x, y
+			res, err := ir.calculateExpression(tokens)
+			ass.NoError(err)
+			exp := res.(float64)
+			res, err = ir.funcs["f"].call(ir, []Value{x, y}, 1)
+			ass.NoError(err)
+			act := res.(float64)
+			if math.IsNaN(exp) {
+				ass.True(math.IsNaN(act), "%s x=%v y=%v", expr, x, y)
+				continue
+			}
+			ass.Equal(exp, act, "%s => %s, x=%v y=%v", expr, ir.funcs["f"].optimizedString(ir), x, y)
+		}
+
+		// optimized form is valid expression with same meaning
+		opt := ir.funcs["f"].optimizedString(ir)
+		if !strings.Contains(opt, "where") && !strings.Contains(opt, "Inf") {
+			ass.Equal("", ir.ProcessInstruction("@g = "+opt))
+			ass.Equal(opt, ir.funcs["g"].optimizedString(ir))
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package gocalc
+
+import (
+	"errors"
+	"math"
+)
+
+// minPriority is priority of operators with lowest precedence
+const minPriority = 0
+
+// parser builds expression tree from tokens with precedence climbing
+// after syntax error it goes on to find other errors
+type parser struct {
+	tokens []*Token
+	pos    int
+	parens []*Token // open parens
+	errs   ErrorList
+}
+
+// Parse builds expression tree from tokens in infix notation
+// function tokens get argument count of call
+// all syntax errors are reported together as ErrorList (single error as *Error)
+func Parse(tokens []*Token) (*Node, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("nothing to calculate")
+	}
+	p := &parser{tokens: tokens}
+	n := p.parseCond()
+	p.rest(nil, false)
+	if len(p.errs) > 0 {
+		p.errs.sort()
+		return nil, p.errs.Err()
+	}
+	return n, nil
+}
+
+// ParseString tokenizes and parses expression
+// all errors of tokenizer and parser are reported together
+func ParseString(expr string) (*Node, error) {
+	tokens, err := NewStringTokenizer(expr).Tokens()
+	tree, perr := Parse(tokens)
+	if err == nil {
+		return tree, perr
+	}
+	errs := ErrorList{}
+	errs.addAll(err)
+	errs.addAll(perr)
+	errs.sort()
+	return nil, errs.Err()
+}
+
+func (p *parser) peek() *Token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() *Token {
+	tok := p.peek()
+	if tok != nil {
+		p.pos++
+	}
+	return tok
+}
+
+// isBinary reports if tok is binary operator
+func isBinary(tok *Token) bool {
+	if tok == nil || tok.Type != TokenOperator || isUnary(tok) ||
+		tok.Operator == "(" || tok.Operator == ")" {
+
+		return false
+	}
+	_, ok := opPriority[tok.Operator]
+	return ok
+}
+
+// startsOperand reports if tok can be first token of operand
+func startsOperand(tok *Token) bool {
+	return tok.Type == TokenNumber || tok.Type == TokenVariable ||
+		tok.Type == TokenFunction || tok.Operator == "(" || isUnary(tok)
+}
+
+// badNode stands for operand that could not be parsed
+func badNode(pos int) *Node {
+	tok := &Token{Type: TokenNumber, Pos: pos, End: pos, Number: math.NaN()}
+	return &Node{Kind: NodeNumber, Tok: tok, Pos: pos, End: pos}
+}
+
+// parseExpr parses operands joined with operators of priority at least min
+func (p *parser) parseExpr(min int) *Node {
+	left := p.parseOperand()
+	for tok := p.peek(); isBinary(tok) && opPriority[tok.Operator] >= min; tok = p.peek() {
+		p.next()
+		next := opPriority[tok.Operator] + 1
+		if rightAssoc[tok.Operator] {
+			next--
+		}
+		left = opNode(tok, left, p.parseExpr(next))
+	}
+	return left
+}
+
+// parseCond parses expression with conditional operator cond ? then : else (right associative)
+func (p *parser) parseCond() *Node {
+	cond := p.parseExpr(minPriority)
+	tok := p.peek()
+	if tok == nil || tok.Operator != "?" {
+		return cond
+	}
+	p.next()
+	then := p.parseCond()
+	if colon := p.peek(); colon == nil || colon.Delimiter != ":" {
+		p.errs.add(tokenError(tok, "missing : for %s", tok))
+		return condNode(tok, cond, then, badNode(then.End))
+	}
+	p.next()
+	return condNode(tok, cond, then, p.parseCond())
+}
+
+// parseOperand parses number, variable, call, unary operator or expression in parens
+func (p *parser) parseOperand() *Node {
+	tok := p.peek()
+	switch {
+	case tok == nil:
+		p.errs.add(p.unexpectedEnd())
+		return badNode(p.end())
+	case len(p.parens) > 0 && (tok.Operator == ")" || tok.Delimiter == ","):
+		// left for enclosing parens or call
+		p.errs.add(tokenError(tok, "unexpected %s", tok))
+		return badNode(tok.Pos)
+	}
+	p.next()
+	switch {
+	case tok.Type == TokenBad:
+		// already reported by tokenizer, it may be prefix of operand
+		if next := p.peek(); next != nil && startsOperand(next) {
+			return p.parseOperand()
+		}
+		return badNode(tok.Pos)
+	case tok.Operator == ")":
+		p.errs.add(tokenError(tok, "parens not matching"))
+		return p.parseOperand()
+	case tok.Type == TokenNumber || tok.Type == TokenVariable:
+		return leafNode(tok)
+	case tok.Type == TokenFunction:
+		return p.parseCall(tok)
+	case isUnary(tok):
+		return opNode(tok, p.parseExpr(opPriority[tok.Operator]))
+	case tok.Operator == "(":
+		p.parens = append(p.parens, tok)
+		n := p.parseCond()
+		if closing := p.rest(tok, false); closing != nil {
+			n.Pos, n.End = tok.Pos, closing.End
+		}
+		return n
+	}
+	// skipped, operand may follow
+	p.errs.add(tokenError(tok, "unexpected %s", tok))
+	return p.parseOperand()
+}
+
+// parseCall parses arguments of call of function tok
+func (p *parser) parseCall(tok *Token) *Node {
+	open := p.peek()
+	if open == nil || open.Operator != "(" {
+		p.errs.add(tokenError(tok, "expected ( after %s", tok))
+		return badNode(tok.Pos)
+	}
+	p.next()
+	p.parens = append(p.parens, open)
+	n := &Node{Kind: NodeCall, Tok: tok, Pos: tok.Pos, End: p.end()}
+	if next := p.peek(); next != nil && next.Operator == ")" {
+		n.End = p.rest(open, true).End
+		tok.Argc = 0
+		return n
+	}
+	for {
+		n.Args = append(n.Args, p.parseCond())
+		stop := p.rest(open, true)
+		if stop == nil || stop.Delimiter != "," {
+			if stop != nil {
+				n.End = stop.End
+			}
+			tok.Argc = len(n.Args)
+			return n
+		}
+	}
+}
+
+// rest reports unexpected tokens after complete expression until paren closing open
+// (end of tokens for nil) or comma (if comma is allowed),
+// returns closing paren or comma (nil if it is not found)
+func (p *parser) rest(open *Token, comma bool) *Token {
+	// operand right after skipped token is not reported
+	skipped := false
+	for {
+		tok := p.peek()
+		switch {
+		case tok == nil:
+			if open != nil {
+				p.errs.add(tokenError(open, "parens not matching"))
+				p.parens = p.parens[:len(p.parens)-1]
+			}
+			return nil
+		case tok.Operator == ")" && open != nil:
+			p.next()
+			p.parens = p.parens[:len(p.parens)-1]
+			return tok
+		case tok.Operator == ")":
+			p.next()
+			p.errs.add(tokenError(tok, "parens not matching"))
+			skipped = true
+		case comma && tok.Delimiter == ",":
+			p.next()
+			return tok
+		case tok.Type == TokenBad:
+			p.next()
+			skipped = true
+		case startsOperand(tok):
+			if !skipped {
+				p.errs.add(tokenError(tok, "missing operator before %s", tok))
+			}
+			p.parseCond()
+			skipped = false
+		default:
+			p.next()
+			p.errs.add(tokenError(tok, "unexpected %s", tok))
+			skipped = true
+		}
+	}
+}
+
+// end returns position after last token
+func (p *parser) end() int {
+	return p.tokens[len(p.tokens)-1].End
+}
+
+// unexpectedEnd returns error for end of tokens, unclosed paren is reported first
+func (p *parser) unexpectedEnd() *Error {
+	if len(p.parens) > 0 {
+		return tokenError(p.parens[len(p.parens)-1], "parens not matching")
+	}
+	return newError(p.end(), "unexpected end of expression")
+}
@@ -0,0 +1,172 @@
+package gocalc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input, output string
+	}{
+		{"1 + 2 * 3", "1 + 2 * 3"},
+		{"(1 + 2) * 3", "(1 + 2) * 3"},
+		{"((x))", "x"},
+		{"2 - (3 - 4)", "2 - (3 - 4)"},
+		{"(2 - 3) - 4", "2 - 3 - 4"},
+		{"2 ^ 3 ^ 2", "2 ^ 3 ^ 2"},
+		{"(2 ^ 3) ^ 2", "(2 ^ 3) ^ 2"},
+		{"-2 ^ 2", "-2 ^ 2"},
+		{"(-2) ^ 2", "(-2) ^ 2"},
+		{"2 ^ -x * 3", "2 ^ -x * 3"},
+		{"@f() + @g((1), 2 + 3, -x)", "@f() + @g(1, 2 + 3, -x)"},
+		{"x > 0 ? x : -x", "x > 0 ? x : -x"},
+		{"a ? b : c ? d : e", "a ? b : c ? d : e"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? (b ? c : d) : e", "a ? (b ? c : d) : e"},
+		{"1 + (a ? b : c) * 2", "1 + (a ? b : c) * 2"},
+		{"!a && b || c == d < e", "!a && b || c == d < e"},
+		{"a && (b || c)", "a && (b || c)"},
+		{"!(a < b)", "!(a < b)"},
+		{"@f(a ? b : c, d)", "@f(a ? b : c, d)"},
+	}
+	for _, test := range tests {
+		tree, err := ParseString(test.input)
+		if ass.NoError(err, test.input) {
+			ass.Equal(test.output, tree.String(), test.input)
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	ass := assert.New(t)
+	tree, err := ParseString("-a * @f(b, 2)")
+	if !ass.NoError(err) {
+		return
+	}
+	ass.Equal(NodeBinary, tree.Kind)
+	ass.Equal(0, tree.Pos)
+	ass.Equal(13, tree.End)
+
+	neg, call := tree.Args[0], tree.Args[1]
+	ass.Equal(NodeUnary, neg.Kind)
+	ass.Equal(NodeVariable, neg.Args[0].Kind)
+	ass.Equal(NodeCall, call.Kind)
+	ass.Equal(2, call.Tok.Argc)
+	ass.Equal(5, call.Pos)
+	ass.Equal(13, call.End)
+	ass.Equal(NodeNumber, call.Args[1].Kind)
+	ass.Equal(11, call.Args[1].Pos)
+
+	kinds := []int{}
+	tree.Walk(func(n *Node) {
+		kinds = append(kinds, n.Kind)
+	})
+	ass.Equal([]int{NodeBinary, NodeUnary, NodeVariable, NodeCall, NodeVariable, NodeNumber}, kinds)
+}
+
+func TestParseErrors(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{"2 3 +", 2, "missing operator before 3"},
+		{"@f(1,,2)", 5, "unexpected ,"},
+		{"2 + (3", 4, "parens not matching"},
+		{"2 + 3)", 5, "parens not matching"},
+		{"@f(1, 2", 2, "parens not matching"},
+		{"2 *", 3, "unexpected end of expression"},
+		{"* 2", 0, "unexpected *"},
+		{"()", 1, "unexpected )"},
+		{"(1 2)", 3, "missing operator before 2"},
+		{"x (1)", 2, "missing operator before ("},
+		{"@f + 1", 0, "expected ( after @f"},
+		{"1, 2", 1, "unexpected ,"},
+		{"a ? b", 2, "missing : for ?"},
+		{"a ? b : ", 7, "unexpected end of expression"},
+		{"a : b", 2, "unexpected :"},
+		{"? a : b", 0, "unexpected ?"},
+	}
+	for _, test := range tests {
+		_, err := ParseString(test.input)
+		var perr *Error
+		if ass.True(errors.As(err, &perr), test.input) {
+			ass.Equal(test.pos, perr.Pos, test.input)
+			ass.Equal(test.msg, perr.Msg, test.input)
+		}
+	}
+
+	_, err := ParseString("")
+	ass.Error(err)
+}
+
+func TestParseRecovery(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{"2 3 + (4", []string{
+			"at index 2: missing operator before 3",
+			"at index 6: parens not matching",
+		}},
+		{"@f(1,,2) + ) (3 4)", []string{
+			"at index 5: unexpected ,",
+			"at index 11: parens not matching",
+			"at index 16: missing operator before 4",
+		}},
+		{"(1 + ) * @g(, x) +", []string{
+			"at index 5: unexpected )",
+			"at index 12: unexpected ,",
+			"at index 18: unexpected end of expression",
+		}},
+		{"1 $ 2 + (3 + $) $x", []string{
+			"at index 2: bad token",
+			"at index 13: bad token",
+			"at index 16: bad token",
+		}},
+		{"1 : 2 := 3", []string{
+			"at index 2: unexpected :",
+			"at index 6: unexpected :=",
+		}},
+	}
+	for _, test := range tests {
+		_, err := ParseString(test.input)
+		actual := []string{}
+		for _, err := range Errors(err) {
+			actual = append(actual, err.Error())
+		}
+		ass.Equal(test.errors, actual, test.input)
+	}
+
+	_, err := ParseString("1 + (2")
+	var perr *Error
+	ass.True(errors.As(err, &perr))
+	_, err = ParseString("(1 2")
+	if ass.True(errors.As(err, &perr)) {
+		ass.Equal("parens not matching", perr.Msg)
+	}
+	ass.Len(Errors(err), 2)
+}
+
+func TestParseAtDeclaration(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	_, err := ir.Exec("@f = (x): x 2")
+	var perr *Error
+	if ass.True(errors.As(err, &perr)) {
+		ass.Equal(12, perr.Pos)
+	}
+	_, ok := ir.GetFunc("f")
+	ass.False(ok)
+
+	_, err = ir.Exec("a = 2 3")
+	ass.Error(err)
+	_, ok = ir.GetVar("a")
+	ass.False(ok)
+}
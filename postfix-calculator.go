@@ -2,84 +2,195 @@ package gocalc
 
 import (
 	"errors"
+	"math"
 )
 
+// frame of function call
+type frame struct {
+	locals map[string]Value
+	fn     *function
+	depth  int
+}
+
 // calculatePostfix calculates expression in postfix notation
-func (ir *Interpreter) calculatePostfix(input []*Token) (float64, error) {
+func (ir *Interpreter) calculatePostfix(input []*Token) (Value, error) {
+	return ir.evalPostfix(input, nil)
+}
+
+// lookupVar finds variable visible in frame:
+// parameters, then captured variables (if function captured them), then globals and history, then constants
+func (ir *Interpreter) lookupVar(name string, fr *frame) (Value, bool) {
+	if fr != nil {
+		if val, ok := fr.locals[name]; ok {
+			return val, true
+		}
+		if fr.fn.captured != nil {
+			if val, ok := fr.fn.captured[name]; ok {
+				return val, true
+			}
+			return ir.constant(name)
+		}
+	}
+	if val, ok := ir.vars[name]; ok {
+		return val, true
+	}
+	if val, ok := ir.historyValue(name); ok {
+		return val, true
+	}
+	return ir.constant(name)
+}
+
+// evalPostfix calculates expression in postfix notation inside of frame (nil for top level)
+func (ir *Interpreter) evalPostfix(input []*Token, fr *frame) (Value, error) {
 	if len(input) == 0 {
-		return 0, errors.New("nothing to calculate")
+		return nil, errors.New("nothing to calculate")
 	}
 
-	stack := []float64{}
-	for _, tok := range input {
+	stack := []Value{}
+	for i := 0; i < len(input); i++ {
+		tok := input[i]
 		if tok.Type == TokenNumber {
-			stack = append(stack, tok.Number)
+			val, err := ir.num.number(tok)
+			if err != nil {
+				return nil, tokenError(tok, "%v", err)
+			}
+			stack = append(stack, val)
 			continue
 		}
 
 		if tok.Type == TokenVariable {
-			val, ok := ir.vars[tok.Variable]
+			val, ok := ir.lookupVar(tok.Variable, fr)
 			if !ok {
-				return 0, newIndexedError(tok.Pos, "unknown variable: %v", tok)
+				return nil, tokenError(tok, "unknown variable: %v", tok)
 			}
 			stack = append(stack, val)
 			continue
 		}
+		if tok.Type == TokenOperator && logicOps[tok.Operator] {
+			if len(stack) < 1 {
+				return nil, tokenError(tok, "not enough operands for %s", tok)
+			}
+			top := len(stack) - 1
+			switch tok.Operator {
+			case "?":
+				if !ir.num.truth(stack[top]) {
+					i += tok.Jump
+				}
+				stack = stack[:top]
+			case ":":
+				// end of then branch
+				i += tok.Jump
+			case "&&", "||":
+				// result is known if left operand is false for && or true for ||
+				if ir.num.truth(stack[top]) == (tok.Operator == "||") {
+					stack[top] = ir.boolValue(tok.Operator == "||")
+					i += tok.Jump
+				} else {
+					stack = stack[:top]
+				}
+			case "u!":
+				stack[top] = ir.boolValue(!ir.num.truth(stack[top]))
+			case "ubool":
+				stack[top] = ir.boolValue(ir.num.truth(stack[top]))
+			}
+			continue
+		}
 		if isUnary(tok) {
 			if len(stack) < 1 {
-				return 0, newIndexedError(tok.Pos, "not enough operands for %s", tok)
+				return nil, tokenError(tok, "not enough operands for %s", tok)
 			}
-			if tok.Operator == "u-" {
-				stack[len(stack)-1] *= -1
+			res, err := ir.num.unary(tok.Operator, stack[len(stack)-1])
+			if err != nil {
+				return nil, tokenError(tok, "%v", err)
 			}
+			stack[len(stack)-1] = res
 			continue
 		}
 		if tok.Type == TokenFunction {
-			name := tok.Function
-			fn, ok := ir.funcs[name]
-			if !ok {
-				return 0, newIndexedError(tok.Pos, "unknown function %s", tok)
-			}
-
-			if len(stack) < len(fn.params) {
-				return 0, newIndexedError(tok.Pos, "not enougn params to call function %s", tok)
+			if len(stack) < tok.Argc {
+				return nil, tokenError(tok, "not enougn params to call function %s", tok)
 			}
 
-			args := stack[len(stack)-len(fn.params):]
-			stack = stack[:len(stack)-len(fn.params)]
-			res, err := fn.call(args)
+			args := append([]Value(nil), stack[len(stack)-tok.Argc:]...)
+			stack = stack[:len(stack)-tok.Argc]
+			res, err := ir.callFunc(tok, args, fr)
 			if err != nil {
-				return 0, newIndexedError(tok.Pos, "call %s: %v", tok, err)
+				return nil, err
 			}
 			stack = append(stack, res)
 			continue
 		}
 		if tok.Type != TokenOperator {
-			return 0, newIndexedError(tok.Pos, "unknown token type")
+			return nil, tokenError(tok, "unknown token type")
 		}
 		if len(stack) < 2 {
-			return 0, newIndexedError(tok.Pos, "not enough operands for %s", tok)
+			return nil, tokenError(tok, "not enough operands for %s", tok)
 		}
 		b := stack[len(stack)-1]
 		a := stack[len(stack)-2]
 		stack = stack[:len(stack)-2]
-		switch tok.Operator {
-		case "+":
-			stack = append(stack, a+b)
-		case "-":
-			stack = append(stack, a-b)
-		case "*":
-			stack = append(stack, a*b)
-		case "/":
-			stack = append(stack, a/b)
-		default:
-			return 0, newIndexedError(tok.Pos, "unknown operator %s", tok)
+		var res Value
+		var err error
+		if conversionOps[tok.Operator] {
+			res, err = ir.convertUnit(tok, a, b)
+		} else {
+			res, err = ir.num.binary(tok.Operator, a, b)
 		}
+		if err != nil {
+			return nil, tokenError(tok, "%v", err)
+		}
+		stack = append(stack, res)
 	}
 
 	if len(stack) > 1 {
-		return 0, errors.New("not enough operators to calculate result")
+		return nil, tokensError(input, "not enough operators to calculate result")
 	}
 
 	return stack[0], nil
 }
+
+// applyOperator calculates binary operator, reports false if operator is unknown
+func applyOperator(op string, a, b float64) (float64, bool) {
+	switch op {
+	case "+":
+		return a + b, true
+	case "-":
+		return a - b, true
+	case "*", "mul": // mul is implicit multiplication of unit mode
+		return a * b, true
+	case "/":
+		return a / b, true
+	case "//":
+		return math.Floor(a / b), true
+	case "%":
+		return mod(a, b), true
+	case "^", "**":
+		return math.Pow(a, b), true
+	case "==":
+		return boolFloat(a == b), true
+	case "!=":
+		return boolFloat(a != b), true
+	case "<":
+		return boolFloat(a < b), true
+	case "<=":
+		return boolFloat(a <= b), true
+	case ">":
+		return boolFloat(a > b), true
+	case ">=":
+		return boolFloat(a >= b), true
+	case "&&":
+		return boolFloat(a != 0 && b != 0), true
+	case "||":
+		return boolFloat(a != 0 || b != 0), true
+	}
+	return 0, false
+}
+
+// mod is modulo with sign of divisor, so a == (a // b) * b + a % b
+func mod(a, b float64) float64 {
+	res := math.Mod(a, b)
+	if res != 0 && (res < 0) != (b < 0) {
+		res += b
+	}
+	return res
+}
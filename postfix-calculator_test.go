@@ -8,8 +8,9 @@ import (
 
 func TestCalculatePostfix(t *testing.T) {
 	var ir = &Interpreter{
-		vars: map[string]float64{
-			"x": 5,
+		num: floatNumeric{},
+		vars: map[string]Value{
+			"x": 5.0,
 			"y": 10.5,
 		},
 		funcs: map[string]*function{
@@ -81,19 +82,19 @@ func TestCalculatePostfix(t *testing.T) {
 		},
 		{
 			input: []*Token{
-				Num(3), Func("foo"),
+				Num(3), Call("foo", 1),
 			},
 			answer: -6,
 		},
 		{
 			input: []*Token{
-				Num(3), Num(2), Op("+"), Func("foo"),
+				Num(3), Num(2), Op("+"), Call("foo", 1),
 			},
 			answer: -10,
 		},
 		{
 			input: []*Token{
-				Num(3), Num(2), Op("+"), Num(5), Op("/"), Func("foo"), UnOp("-"),
+				Num(3), Num(2), Op("+"), Num(5), Op("/"), Call("foo", 1), UnOp("-"),
 			},
 			answer: 2,
 		},
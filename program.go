@@ -0,0 +1,343 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Program instruction codes
+const (
+	opConst = iota
+	opLoad
+	opNeg
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opFloorDiv
+	opMod
+	opPow
+	opEq
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+	opNot
+	opBool
+	opJumpFalse // pops condition, jumps if it's false
+	opJump
+	opAnd // jumps if top is false, pops it otherwise
+	opOr  // jumps if top is true (replaced with 1), pops it otherwise
+	opCall
+)
+
+var binaryOpCodes = map[string]int{
+	"+":  opAdd,
+	"-":  opSub,
+	"*":  opMul,
+	"/":  opDiv,
+	"//": opFloorDiv,
+	"%":  opMod,
+	"^":  opPow,
+	"**": opPow,
+	"==": opEq,
+	"!=": opNe,
+	"<":  opLt,
+	"<=": opLe,
+	">":  opGt,
+	">=": opGe,
+}
+
+// jumpOpCodes are codes of jump tokens of postfix notation
+var jumpOpCodes = map[string]int{
+	"?":  opJumpFalse,
+	":":  opJump,
+	"&&": opAnd,
+	"||": opOr,
+}
+
+type instr struct {
+	code int
+	num  float64 // constant for opConst
+	slot int     // slot index for opLoad, argument count for opCall, target for jumps
+	tok  *Token  // source token (for calls and errors)
+}
+
+// Program is expression compiled once for many evaluations
+// variables of expression are resolved to slots
+// program calculates with float64 in any numeric mode of interpreter except unit mode
+type Program struct {
+	ir    *Interpreter
+	code  []instr
+	slots []string
+}
+
+// Compile compiles expression with fresh interpreter
+func Compile(expr string) (*Program, error) {
+	return NewInterpreter(false, 0).Compile(expr)
+}
+
+// Compile compiles expression, functions are taken from interpreter when program evaluates
+func (ir *Interpreter) Compile(expr string) (*Program, error) {
+	if ir.isUnitMode() {
+		return nil, errors.New("program can't calculate quantities with units")
+	}
+	// operators of integer modes (xor, wrapping, integer division) have no float64 meaning
+	if _, ok := ir.num.(*intNumeric); ok {
+		return nil, errors.New("program can't calculate in integer modes")
+	}
+	tokens, err := NewStringTokenizer(expr).Tokens()
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("nothing to calculate")
+	}
+	if tokens[0].Type == TokenMetaCommand || isAssignment(tokens) {
+		return nil, errors.New("not an expression")
+	}
+	postfix, err := ir.infixToPostfix(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// operands are counted ahead so evaluation can skip stack checks
+	p := &Program{ir: ir}
+	slotIndex := map[string]int{}
+	depth := 0
+	// instruction index of each token, so jumps over tokens can be resolved
+	starts := make([]int, len(postfix)+1)
+	for i, tok := range postfix {
+		starts[i] = len(p.code)
+		switch {
+		case tok.Type == TokenNumber && tok.Imag:
+			return nil, tokenError(tok, "%v", errImag)
+		case tok.Type == TokenNumber:
+			p.code = append(p.code, instr{code: opConst, num: tok.Number, tok: tok})
+			depth++
+		case tok.Type == TokenVariable:
+			slot, ok := slotIndex[tok.Variable]
+			if !ok {
+				slot = len(p.slots)
+				slotIndex[tok.Variable] = slot
+				p.slots = append(p.slots, tok.Variable)
+			}
+			p.code = append(p.code, instr{code: opLoad, slot: slot, tok: tok})
+			depth++
+		case tok.Type == TokenFunction:
+			if err := ir.checkCall(tok); err != nil {
+				return nil, err
+			}
+			if depth < tok.Argc {
+				return nil, tokenError(tok, "not enough params to call function %s", tok)
+			}
+			p.code = append(p.code, instr{code: opCall, slot: tok.Argc, tok: tok})
+			depth += 1 - tok.Argc
+		case tok.Type == TokenOperator && jumpOpCodes[tok.Operator] != 0:
+			if depth < 1 {
+				return nil, tokenError(tok, "not enough operands for %s", tok)
+			}
+			// target is resolved after all tokens
+			p.code = append(p.code, instr{code: jumpOpCodes[tok.Operator], slot: i + 1 + tok.Jump, tok: tok})
+			// value of branch or right operand takes place of popped value
+			depth--
+		case isUnary(tok):
+			if depth < 1 {
+				return nil, tokenError(tok, "not enough operands for %s", tok)
+			}
+			if bitwiseOps[tok.Operator] {
+				return nil, tokenError(tok, "%v", opError(tok.Operator))
+			}
+			switch tok.Operator {
+			case "u-":
+				p.code = append(p.code, instr{code: opNeg, tok: tok})
+			case "u!":
+				p.code = append(p.code, instr{code: opNot, tok: tok})
+			case "ubool":
+				p.code = append(p.code, instr{code: opBool, tok: tok})
+			}
+		case tok.Type == TokenOperator:
+			code, ok := binaryOpCodes[tok.Operator]
+			if !ok {
+				return nil, tokenError(tok, "%v", opError(tok.Operator))
+			}
+			if depth < 2 {
+				return nil, tokenError(tok, "not enough operands for %s", tok)
+			}
+			p.code = append(p.code, instr{code: code, tok: tok})
+			depth--
+		default:
+			return nil, tokenError(tok, "unknown token type")
+		}
+	}
+	if depth != 1 {
+		return nil, errors.New("not enough operators to calculate result")
+	}
+	starts[len(postfix)] = len(p.code)
+	for i := range p.code {
+		switch in := &p.code[i]; in.code {
+		case opJumpFalse, opJump, opAnd, opOr:
+			in.slot = starts[in.slot]
+		}
+	}
+
+	return p, nil
+}
+
+// checkCall checks that function of call exists and accepts its argument count
+func (ir *Interpreter) checkCall(tok *Token) error {
+	if fn, ok := ir.funcs[tok.Function]; ok {
+		if len(fn.params) != tok.Argc {
+			return tokenError(tok, "call %s: wrong argument count", tok)
+		}
+		return nil
+	}
+	if b, ok := builtins[tok.Function]; ok {
+		if err := b.checkArgc(tok.Argc); err != nil {
+			return tokenError(tok, "call %s: %v", tok, err)
+		}
+		return nil
+	}
+	return tokenError(tok, "unknown function %s", tok)
+}
+
+// Slots returns names of variables in order of slots for EvalSlots
+func (p *Program) Slots() []string {
+	return append([]string(nil), p.slots...)
+}
+
+// Eval evaluates program, variables missing in vars are taken from interpreter (or constants)
+func (p *Program) Eval(vars map[string]float64) (float64, error) {
+	slots := make([]float64, len(p.slots))
+	for i, name := range p.slots {
+		val, ok := vars[name]
+		if !ok {
+			var v Value
+			if v, ok = p.ir.lookupVar(name, nil); ok {
+				var err error
+				if val, err = programFloat(v); err != nil {
+					return 0, fmt.Errorf("%s: %v", name, err)
+				}
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("unknown variable: %s", name)
+		}
+		slots[i] = val
+	}
+
+	return p.run(slots)
+}
+
+// programFloat converts value of interpreter to float64 for program,
+// quantity with unit is error, not NaN (mode can be changed after compilation)
+func programFloat(v Value) (float64, error) {
+	if q, ok := v.(Quantity); ok && !q.dimensionless() {
+		return 0, fmt.Errorf("value has unit %s", q.unitName())
+	}
+	return toFloat64(v), nil
+}
+
+// EvalSlots evaluates program with values of variables in order of Slots
+func (p *Program) EvalSlots(slots []float64) (float64, error) {
+	if len(slots) != len(p.slots) {
+		return 0, fmt.Errorf("expected %d slots, got %d", len(p.slots), len(slots))
+	}
+
+	return p.run(slots)
+}
+
+func (p *Program) run(slots []float64) (float64, error) {
+	stack := make([]float64, 0, len(p.code))
+	for i := 0; i < len(p.code); i++ {
+		in := &p.code[i]
+		top := len(stack) - 1
+		switch in.code {
+		case opConst:
+			stack = append(stack, in.num)
+		case opLoad:
+			stack = append(stack, slots[in.slot])
+		case opNeg:
+			stack[top] = -stack[top]
+		case opAdd:
+			stack[top-1] += stack[top]
+			stack = stack[:top]
+		case opSub:
+			stack[top-1] -= stack[top]
+			stack = stack[:top]
+		case opMul:
+			stack[top-1] *= stack[top]
+			stack = stack[:top]
+		case opDiv:
+			stack[top-1] /= stack[top]
+			stack = stack[:top]
+		case opFloorDiv:
+			stack[top-1] = math.Floor(stack[top-1] / stack[top])
+			stack = stack[:top]
+		case opMod:
+			stack[top-1] = mod(stack[top-1], stack[top])
+			stack = stack[:top]
+		case opPow:
+			stack[top-1] = math.Pow(stack[top-1], stack[top])
+			stack = stack[:top]
+		case opEq:
+			stack[top-1] = boolFloat(stack[top-1] == stack[top])
+			stack = stack[:top]
+		case opNe:
+			stack[top-1] = boolFloat(stack[top-1] != stack[top])
+			stack = stack[:top]
+		case opLt:
+			stack[top-1] = boolFloat(stack[top-1] < stack[top])
+			stack = stack[:top]
+		case opLe:
+			stack[top-1] = boolFloat(stack[top-1] <= stack[top])
+			stack = stack[:top]
+		case opGt:
+			stack[top-1] = boolFloat(stack[top-1] > stack[top])
+			stack = stack[:top]
+		case opGe:
+			stack[top-1] = boolFloat(stack[top-1] >= stack[top])
+			stack = stack[:top]
+		case opNot:
+			stack[top] = boolFloat(stack[top] == 0)
+		case opBool:
+			stack[top] = boolFloat(stack[top] != 0)
+		case opJumpFalse:
+			if stack[top] == 0 {
+				i = in.slot - 1
+			}
+			stack = stack[:top]
+		case opJump:
+			i = in.slot - 1
+		case opAnd, opOr:
+			if (stack[top] != 0) == (in.code == opOr) {
+				stack[top] = boolFloat(in.code == opOr)
+				i = in.slot - 1
+			} else {
+				stack = stack[:top]
+			}
+		case opCall:
+			args := make([]Value, in.slot)
+			for i, arg := range stack[len(stack)-in.slot:] {
+				val, err := p.ir.num.convert(arg)
+				if err != nil {
+					return 0, tokenError(in.tok, "%v", err)
+				}
+				args[i] = val
+			}
+			res, err := p.ir.callFunc(in.tok, args, nil)
+			if err != nil {
+				return 0, err
+			}
+			f, err := programFloat(res)
+			if err != nil {
+				return 0, tokenError(in.tok, "%v", err)
+			}
+			stack = append(stack[:len(stack)-in.slot], f)
+		}
+	}
+
+	return stack[0], nil
+}
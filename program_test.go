@@ -0,0 +1,172 @@
+package gocalc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgram(t *testing.T) {
+	ir := NewInterpreter(false, 0)
+	ass := assert.New(t)
+	ass.NoError(ir.DefineFunc("lin", []string{"k", "x"}, "k * x + 1"))
+	ass.NoError(ir.SetVar("c", 100))
+
+	p, err := ir.Compile("-(x - y) * @lin(2, x) / 2 + c")
+	ass.NoError(err)
+	ass.Equal([]string{"x", "y", "c"}, p.Slots())
+
+	tests := []struct {
+		x, y, res float64
+	}{
+		{1, 1, 100},
+		{3, 1, 93},
+		{0, 4, 102},
+	}
+	for _, test := range tests {
+		res, err := p.Eval(map[string]float64{"x": test.x, "y": test.y})
+		ass.NoError(err)
+		ass.Equal(test.res, res)
+
+		res, err = p.EvalSlots([]float64{test.x, test.y, 100})
+		ass.NoError(err)
+		ass.Equal(test.res, res)
+	}
+
+	_, err = p.Eval(map[string]float64{"x": 1})
+	ass.Error(err)
+	_, err = p.EvalSlots([]float64{1, 2})
+	ass.Error(err)
+
+	ass.NoError(ir.DefineFunc("lin", []string{"x"}, "x"))
+	_, err = p.EvalSlots([]float64{1, 2, 3})
+	ass.Error(err)
+}
+
+func TestCompileErrors(t *testing.T) {
+	ass := assert.New(t)
+	for _, expr := range []string{"", "a = 2", "2 +", "2 3", "(2", "@nofunc(1)", "@sqrt(1, 2)", "@min()", ";mem"} {
+		_, err := Compile(expr)
+		ass.Error(err, expr)
+	}
+}
+
+func TestCompileUnitMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	p, err := ir.Compile("2 * d")
+	ass.NoError(err)
+	ass.NoError(ir.SetMode(ModeUnit, 0))
+	_, err = ir.Compile("3 km")
+	ass.EqualError(err, "program can't calculate quantities with units")
+
+	ass.Equal("", ir.ProcessInstruction("d = 3 km"))
+	_, err = p.Eval(nil)
+	ass.EqualError(err, "d: value has unit km")
+	ass.Equal("", ir.ProcessInstruction("d = 2 km / 1 km"))
+	res, err := p.Eval(nil)
+	ass.NoError(err)
+	ass.Equal(4.0, res)
+}
+
+func TestCompileIntMode(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	for _, mode := range []string{ModeInt, ModeUint, ModeBigInt} {
+		ass.NoError(ir.SetMode(mode, 0))
+		_, err := ir.Compile("5 ^ 3")
+		ass.EqualError(err, "program can't calculate in integer modes", mode)
+	}
+}
+
+func TestProgramConditions(t *testing.T) {
+	ass := assert.New(t)
+	p, err := Compile("x > 0 && y > 0 ? x * y : !x || y == 2 ? -1 : 0")
+	ass.NoError(err)
+	tests := []struct {
+		x, y, res float64
+	}{
+		{2, 3, 6},
+		{0, 3, -1},
+		{-1, 2, -1},
+		{-1, 3, 0},
+	}
+	for _, test := range tests {
+		res, err := p.EvalSlots([]float64{test.x, test.y})
+		ass.NoError(err)
+		ass.Equal(test.res, res, "x=%v y=%v", test.x, test.y)
+	}
+}
+
+func TestProgramBuiltins(t *testing.T) {
+	ass := assert.New(t)
+	p, err := Compile("@max(x, -x, 0) * pi / @sqrt(4)")
+	ass.NoError(err)
+	ass.Equal([]string{"x", "pi"}, p.Slots())
+	res, err := p.Eval(map[string]float64{"x": -2})
+	ass.NoError(err)
+	ass.InDelta(3.14159265, res, 1e-8)
+}
+
+const benchExpr = "(x - 1) * (x + 1) / (y * y + 2) - -x"
+
+func BenchmarkProcessInstruction(b *testing.B) {
+	ir := NewInterpreter(false, 2)
+	for i := 0; i < b.N; i++ {
+		ir.vars["x"] = float64(i)
+		ir.vars["y"] = float64(2)
+		ir.ProcessInstruction(benchExpr)
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	ir := NewInterpreter(false, 2)
+	for i := 0; i < b.N; i++ {
+		ir.vars["x"] = float64(i)
+		ir.vars["y"] = float64(2)
+		if _, err := ir.Eval(benchExpr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B) {
+	p, err := Compile(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vars := map[string]float64{"y": 2}
+	for i := 0; i < b.N; i++ {
+		vars["x"] = float64(i)
+		if _, err := p.Eval(vars); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEvalSlots(b *testing.B) {
+	p, err := Compile(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	slots := []float64{0, 2}
+	for i := 0; i < b.N; i++ {
+		slots[0] = float64(i)
+		if _, err := p.EvalSlots(slots); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func ExampleProgram_EvalSlots() {
+	p, _ := Compile("a * a + b")
+	for i := 1; i <= 3; i++ {
+		res, _ := p.EvalSlots([]float64{float64(i), 1})
+		fmt.Println(res)
+	}
+	// Output:
+	// 2
+	// 5
+	// 10
+}
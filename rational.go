@@ -0,0 +1,318 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Styles of fractions in output of rat mode
+const (
+	FracFraction = iota // 3/2
+	FracMixed           // 1 1/2
+	FracDecimal         // 1.50 (with precision of interpreter)
+)
+
+var fracStyleNames = map[int]string{
+	FracFraction: "fraction",
+	FracMixed:    "mixed",
+	FracDecimal:  "decimal",
+}
+
+var (
+	errDivZero = errors.New("division by zero")
+	errInf     = errors.New("result is infinite")
+	errTooBig  = errors.New("result is too big")
+)
+
+const (
+	// maxRatBits limits size of numerator and denominator of exact power
+	maxRatBits = 1 << 20
+	// maxRatExp limits decimal exponent of literals in rat mode
+	maxRatExp = 1 << 12
+)
+
+// ratNumeric is arithmetic of rat mode, values are exact fractions *big.Rat
+// operations that can't be exact are calculated with float64 and reported as warnings
+type ratNumeric struct {
+	style int
+	warns []string
+}
+
+func (m *ratNumeric) mode() (string, uint) {
+	return ModeRat, 0
+}
+
+func (m *ratNumeric) number(tok *Token) (Value, error) {
+	if tok.Imag {
+		return nil, errImag
+	}
+	lit := tok.Literal
+	if lit == "" {
+		return m.convert(tok.Number)
+	}
+	if i := strings.IndexAny(lit, "eE"); i >= 0 && !strings.HasPrefix(lit, "0x") {
+		if exp, err := strconv.Atoi(lit[i+1:]); err != nil || exp > maxRatExp || exp < -maxRatExp {
+			return nil, fmt.Errorf("exponent of %s is too big", lit)
+		}
+	}
+	x, ok := new(big.Rat).SetString(lit)
+	if !ok {
+		return nil, fmt.Errorf("bad number %s", lit)
+	}
+	return x, nil
+}
+
+func (m *ratNumeric) convert(v Value) (Value, error) {
+	switch v := v.(type) {
+	case *big.Rat:
+		return new(big.Rat).Set(v), nil
+	case *big.Float:
+		if v.IsInf() {
+			return nil, errInf
+		}
+		x, _ := v.Rat(nil)
+		return x, nil
+	case complex128:
+		if imag(v) != 0 {
+			return nil, errNotReal
+		}
+		return ratFromFloat(real(v))
+	case int64, uint64, *big.Int:
+		return new(big.Rat).SetInt(toBigInt(v)), nil
+	case float64:
+		return ratFromFloat(v)
+	}
+	return nil, fmt.Errorf("can't convert %v", v)
+}
+
+// ratFromFloat converts float64 exactly
+func ratFromFloat(f float64) (*big.Rat, error) {
+	switch {
+	case math.IsNaN(f):
+		return nil, errNaN
+	case math.IsInf(f, 0):
+		return nil, errInf
+	}
+	return new(big.Rat).SetFloat64(f), nil
+}
+
+func (m *ratNumeric) float(v Value) float64 {
+	return toFloat64(v)
+}
+
+func (m *ratNumeric) truth(v Value) bool {
+	return v.(*big.Rat).Sign() != 0
+}
+
+func (m *ratNumeric) constant(name string) (Value, bool) {
+	val, ok := constants[name]
+	if !ok {
+		return nil, false
+	}
+	m.warn("%s is approximated with float64", name)
+	return new(big.Rat).SetFloat64(val), true
+}
+
+// warn reports inexact calculation (once per instruction)
+func (m *ratNumeric) warn(msg string, args ...interface{}) {
+	msg = fmt.Sprintf(msg, args...)
+	for _, w := range m.warns {
+		if w == msg {
+			return
+		}
+	}
+	m.warns = append(m.warns, msg)
+}
+
+func (m *ratNumeric) warnings() []string {
+	warns := m.warns
+	m.warns = nil
+	return warns
+}
+
+func (m *ratNumeric) unary(op string, a Value) (Value, error) {
+	switch op {
+	case "u+":
+		return a, nil
+	case "u-":
+		return new(big.Rat).Neg(a.(*big.Rat)), nil
+	}
+	return nil, opError(op)
+}
+
+func (m *ratNumeric) binary(op string, a, b Value) (Value, error) {
+	x, y := a.(*big.Rat), b.(*big.Rat)
+	z := new(big.Rat)
+	switch op {
+	case "+":
+		return z.Add(x, y), nil
+	case "-":
+		return z.Sub(x, y), nil
+	case "*":
+		return z.Mul(x, y), nil
+	}
+	if compareOps[op] {
+		return z.SetFloat64(boolFloat(compare(op, x.Cmp(y)))), nil
+	}
+	if op == "^" || op == "**" {
+		return m.pow(x, y)
+	}
+	if y.Sign() == 0 {
+		return nil, errDivZero
+	}
+	switch op {
+	case "/":
+		return z.Quo(x, y), nil
+	case "//":
+		return z.SetInt(ratFloor(z.Quo(x, y))), nil
+	case "%":
+		// remainder of floored division like mod of float mode
+		z.SetInt(ratFloor(z.Quo(x, y)))
+		return z.Sub(x, z.Mul(z, y)), nil
+	}
+	return nil, opError(op)
+}
+
+// pow calculates x^y exactly for integer y, other powers are calculated with float64
+func (m *ratNumeric) pow(x, y *big.Rat) (Value, error) {
+	if !y.IsInt() {
+		m.warn("power with fractional exponent is calculated with float64")
+		return m.callFloat(math.Pow, x, y)
+	}
+	if !y.Num().IsInt64() {
+		return nil, errTooBig
+	}
+	n := y.Num().Int64()
+	if n < 0 && x.Sign() == 0 {
+		return nil, errDivZero
+	}
+	bits := maxInt(x.Num().BitLen(), x.Denom().BitLen()) - 1
+	if bits > 0 && (n > maxRatBits/int64(bits) || n < -maxRatBits/int64(bits)) {
+		return nil, errTooBig
+	}
+	exp := big.NewInt(n)
+	exp.Abs(exp)
+	num := new(big.Int).Exp(x.Num(), exp, nil)
+	den := new(big.Int).Exp(x.Denom(), exp, nil)
+	if n < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// callFloat calculates fn with arguments converted to float64
+func (m *ratNumeric) callFloat(fn func(float64, float64) float64, x, y *big.Rat) (Value, error) {
+	f, _ := x.Float64()
+	g, _ := y.Float64()
+	return ratFromFloat(fn(f, g))
+}
+
+func (m *ratNumeric) call(name string, args []Value) (Value, error) {
+	xs := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		xs[i] = arg.(*big.Rat)
+	}
+	x := xs[0]
+	z := new(big.Rat)
+	switch name {
+	case "abs":
+		return z.Abs(x), nil
+	case "re", "conj":
+		return x, nil
+	case "im":
+		return z, nil
+	case "floor":
+		return z.SetInt(ratFloor(x)), nil
+	case "ceil":
+		z.SetInt(ratFloor(z.Neg(x)))
+		return z.Neg(z), nil
+	case "trunc":
+		return z.SetInt(new(big.Int).Quo(x.Num(), x.Denom())), nil
+	case "round":
+		// half away from zero
+		z.Add(z.Abs(x), big.NewRat(1, 2))
+		z.SetInt(ratFloor(z))
+		if x.Sign() < 0 {
+			z.Neg(z)
+		}
+		return z, nil
+	case "sign":
+		return z.SetInt64(int64(x.Sign())), nil
+	case "min", "max":
+		res := x
+		for _, y := range xs[1:] {
+			if cmp := y.Cmp(res); (name == "min" && cmp < 0) || (name == "max" && cmp > 0) {
+				res = y
+			}
+		}
+		return res, nil
+	case "sqrt":
+		if x.Sign() < 0 {
+			return nil, errNaN
+		}
+		if root, ok := ratSqrt(x); ok {
+			return root, nil
+		}
+	case "hypot":
+		z.Add(z.Mul(x, x), new(big.Rat).Mul(xs[1], xs[1]))
+		if root, ok := ratSqrt(z); ok {
+			return root, nil
+		}
+	}
+
+	m.warn("@%s is calculated with float64", name)
+	floats := make([]float64, len(xs))
+	for i, x := range xs {
+		floats[i], _ = x.Float64()
+	}
+	return ratFromFloat(builtins[name].fn(floats))
+}
+
+// ratFloor returns greatest integer less than or equal to x
+func ratFloor(x *big.Rat) *big.Int {
+	// euclidean division rounds down for positive denominator
+	return new(big.Int).Div(x.Num(), x.Denom())
+}
+
+// ratSqrt calculates square root of non negative x if it is exact
+func ratSqrt(x *big.Rat) (*big.Rat, bool) {
+	num := new(big.Int).Sqrt(x.Num())
+	den := new(big.Int).Sqrt(x.Denom())
+	root := new(big.Rat).SetFrac(num, den)
+	return root, new(big.Rat).Mul(root, root).Cmp(x) == 0
+}
+
+func (m *ratNumeric) format(v Value, precision int) string {
+	x := v.(*big.Rat)
+	switch m.style {
+	case FracDecimal:
+		return x.FloatString(precision)
+	case FracMixed:
+		whole := new(big.Int).Quo(x.Num(), x.Denom())
+		if x.IsInt() || whole.Sign() == 0 {
+			return x.RatString()
+		}
+		rest := new(big.Int).Rem(x.Num(), x.Denom())
+		return fmt.Sprintf("%s %s/%s", whole, rest.Abs(rest), x.Denom())
+	}
+	return x.RatString()
+}
+
+func (m *ratNumeric) literal(v Value) string {
+	return v.(*big.Rat).RatString()
+}
+
+// FracStyle returns style of fractions in output of rat mode
+func (ir *Interpreter) FracStyle() int {
+	return ir.fracStyle
+}
+
+// SetFracStyle sets style of fractions in output of rat mode (FracFraction, FracMixed, FracDecimal)
+func (ir *Interpreter) SetFracStyle(style int) {
+	ir.fracStyle = style
+	ir.num = ir.configure(ir.num)
+}
@@ -0,0 +1,161 @@
+package gocalc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RunScript executes instructions from input line by line and writes their results to output
+// errors are labeled with name of script and line number (if name is not empty),
+// line ending with backslash continues on next line,
+// script stops after ;quit, its results are not added to history
+func (ir *Interpreter) RunScript(name string, input io.Reader, output io.Writer) error {
+	return ir.runScript(name, input, output, false)
+}
+
+// runScript executes script, results are added to history if record is set (input of non-interactive session)
+func (ir *Interpreter) runScript(name string, input io.Reader, output io.Writer, record bool) error {
+	t := &tokenizer{reader: bufio.NewReader(input), lines: true}
+	for !ir.done {
+		sl, err := t.nextLine()
+		if err == EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		results, err := ir.execAll(sl.source, sl.tokens, sl.err, record)
+		for _, res := range results {
+			if out := ir.printExecResult(res); out != "" {
+				fmt.Fprintln(output, out)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(output, ir.printScriptError(name, sl.line, sl.source, err))
+		}
+	}
+	return nil
+}
+
+// scriptLine is line of script with lines continued by it
+type scriptLine struct {
+	tokens []*Token // positions are counted from start of source
+	err    error    // bad tokens
+	source string   // backslashes of continued lines are replaced with spaces
+	line   int      // line of script (from 1)
+}
+
+// nextLine returns next line of script (tokenizer is in lines mode), EOF at end of script
+func (t *tokenizer) nextLine() (*scriptLine, error) {
+	t.advance(t.lineStart)
+	start, line := t.offset+t.lineStart, t.line+1
+	tokens, end, err := t.collect()
+	switch err.(type) {
+	case nil, *Error, ErrorList:
+	default:
+		// error of reader
+		return nil, err
+	}
+	if end && len(tokens) == 0 && err == nil {
+		return nil, EOF
+	}
+	// last line can end without end of line
+	t.lineStart = t.pos
+
+	source := []byte(strings.TrimSuffix(t.data[start-t.offset:t.pos], "\n"))
+	for _, join := range t.joins {
+		source[join-start] = ' '
+	}
+	t.joins = nil
+	for _, tok := range tokens {
+		tok.Pos -= start
+		tok.End -= start
+	}
+	for _, err := range Errors(err) {
+		err.(*Error).Pos -= start
+		err.(*Error).End -= start
+	}
+	return &scriptLine{tokens: tokens, err: err, source: string(source), line: line}, nil
+}
+
+// printScriptError prints error labeled with name:line:col of script,
+// input starts at line of script and can have several lines
+func (ir *Interpreter) printScriptError(name string, line int, input string, err error) string {
+	if name == "" {
+		return ir.printError(input, err)
+	}
+	lines := []string{}
+	for _, err := range Errors(err) {
+		var perr *Error
+		if errors.As(err, &perr) {
+			offset, col := linePosition(input, perr)
+			lines = append(lines, fmt.Sprintf("%s:%d:%d: error: %s", name, line+offset, col, perr.Msg))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d: error: %v", name, line, err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// linePosition returns line of error in input (from 0) and display column of error in this line (from 1)
+func linePosition(input string, err *Error) (int, int) {
+	pos := minInt(err.Pos, len(input))
+	start := strings.LastIndexByte(input[:pos], '\n') + 1
+	inLine := &Error{Pos: pos - start}
+	return strings.Count(input[:start], "\n"), inLine.Column(input[start:])
+}
+
+// RunFile executes script file (see RunScript)
+func (ir *Interpreter) RunFile(path string, output io.Writer) error {
+	if err := ir.enterFile(path); err != nil {
+		return err
+	}
+	defer ir.leaveFile(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ir.RunScript(path, file, output)
+}
+
+// LoadInitFile executes init file with predefined variables and functions
+// file is remembered to be executed again with ;reload (even if it does not exist yet)
+func (ir *Interpreter) LoadInitFile(path string, output io.Writer) error {
+	ir.initFile = path
+	return ir.RunFile(path, output)
+}
+
+// enterFile marks file as being executed, file that is already being executed can't be executed again
+// (init file with ;reload or script with ;load of itself would execute itself forever)
+func (ir *Interpreter) enterFile(path string) error {
+	key := filePathKey(path)
+	if ir.loading[key] {
+		return fmt.Errorf("recursive load of %s", path)
+	}
+	if ir.loading == nil {
+		ir.loading = map[string]bool{}
+	}
+	ir.loading[key] = true
+	return nil
+}
+
+// leaveFile marks end of execution of file
+func (ir *Interpreter) leaveFile(path string) {
+	delete(ir.loading, filePathKey(path))
+}
+
+// filePathKey returns absolute path of file (path itself if it is unknown)
+func filePathKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,111 @@
+package gocalc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunScript(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 1)
+	input := "a = 2\n" +
+		"\n" +
+		"a * 3\n" +
+		"b = (\n" +
+		"@sq = (x): x * x\n" +
+		"@sq(a + 1)\n"
+	buf := &strings.Builder{}
+
+	ass.NoError(ir.RunScript("test.calc", strings.NewReader(input), buf))
+	ass.Equal("6.0\n"+
+		"test.calc:4:5: error: parens not matching\n"+
+		"9.0\n", buf.String())
+
+	buf.Reset()
+	ass.NoError(ir.Start(strings.NewReader("a\nc\n"), buf))
+	ass.Equal("2.0\nerror: at index 0: unknown variable: c\n", buf.String())
+}
+
+func TestLoadInitFile(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	path := filepath.Join(t.TempDir(), "init.calc")
+
+	ass.Equal("error: no init file", ir.ProcessInstruction(";reload"))
+	ass.Error(ir.LoadInitFile(path, &strings.Builder{}))
+	ass.Equal("", ir.ProcessInstruction("rate = 1"))
+
+	ass.NoError(os.WriteFile(path, []byte("rate = 0.2\n@tax = (x): x * rate\n"), 0644))
+	ass.Equal("", ir.ProcessInstruction(";reload"))
+	ass.Equal("20", ir.ProcessInstruction("@tax(100)"))
+
+	ass.NoError(os.WriteFile(path, []byte("rate = 0.5\nrate\nunknown\n"), 0644))
+	ass.Equal("0\n"+path+":3:1: error: unknown variable: unknown", ir.ProcessInstruction(";reload"))
+	ass.Equal("50", ir.ProcessInstruction("@tax(100)"))
+
+	// init file can't reload itself
+	ass.NoError(os.WriteFile(path, []byte("n = 1\n;reload\nn = n + 1\n"), 0644))
+	ass.Equal(path+":2: error: recursive load of "+path, ir.ProcessInstruction(";reload"))
+	ass.Equal("2", ir.ProcessInstruction("n"))
+	ass.NoError(os.WriteFile(path, []byte("n = 5\n"), 0644))
+	ass.Equal("", ir.ProcessInstruction(";reload"))
+	ass.Equal("5", ir.ProcessInstruction("n"))
+}
+
+func TestScriptSyntax(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 1)
+	input := "# constants\n" +
+		"g = 9.81 # m/s^2\n" +
+		"@fall = (t): \\\n" +
+		"  g * t ^ 2 \\  # continued\n" +
+		"  / 2\n" +
+		"a = 1, b = 2, a + b\n" +
+		"@f = (x, y): x + y, @f(a, b) * 2\n" +
+		"@fall(1) + \\\n" +
+		"  x * 2 + \\\n" +
+		"  y\n" +
+		"c = 3, d, c\n" +
+		";mode # comment\n" +
+		"@fall(2)\n"
+	buf := &strings.Builder{}
+
+	ass.NoError(ir.RunScript("test.calc", strings.NewReader(input), buf))
+	ass.Equal("3.0\n"+
+		"6.0\n"+
+		"test.calc:9:3: error: unknown variable: x\n"+
+		"test.calc:10:3: error: unknown variable: y\n"+
+		"test.calc:11:8: error: unknown variable: d\n"+
+		"mode: float\n"+
+		"19.6\n", buf.String())
+	ass.Equal(3.0, ir.vars["c"])
+	ass.Empty(ir.History())
+
+	// input of non-interactive session is added to history
+	buf.Reset()
+	ass.NoError(ir.Start(strings.NewReader("1 + \\\n2\n_1 * 2\n"), buf))
+	ass.Equal("3.0\n6.0\n", buf.String())
+	ass.Equal("1 + 2", ir.History()[0].Input)
+}
+
+func TestRunScriptStream(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	// line longer than 64KB
+	input := "x = 1 " + strings.Repeat("+ 1 ", 20000) + "\n" +
+		"x\n" +
+		"x $ y"
+	buf := &strings.Builder{}
+	ass.NoError(ir.RunScript("long.calc", strings.NewReader(input), buf))
+	ass.Equal("20001\nlong.calc:3:3: error: bad token\n", buf.String())
+
+	buf.Reset()
+	err := ir.RunScript("", iotest.TimeoutReader(strings.NewReader("x\nx + 1\n")), buf)
+	ass.Equal(iotest.ErrTimeout, err)
+	ass.Equal("20001\n20002\n", buf.String())
+}
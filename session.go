@@ -0,0 +1,204 @@
+package gocalc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LineError is an error of instruction at line of script
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LoadReport describes what went wrong while loading session
+type LoadReport struct {
+	Conflicts []string     // existing variables and functions replaced with other values
+	Errors    []*LineError // failed instructions
+}
+
+// formatLiteral formats float as expression that gives exactly same value
+func formatLiteral(val float64) string {
+	switch {
+	case math.IsNaN(val):
+		return "0 / 0"
+	case math.IsInf(val, 1):
+		return "1 / 0"
+	case math.IsInf(val, -1):
+		return "-1 / 0"
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+// literalTokens returns tokens of expression giving exactly val
+// (in parens if it is not a plain number)
+func (ir *Interpreter) literalTokens(val Value) []*Token {
+	tokens, _ := NewStringTokenizer(ir.num.literal(val)).Tokens()
+	if len(tokens) == 1 {
+		return tokens
+	}
+	return append(append([]*Token{Op("(")}, tokens...), Op(")"))
+}
+
+// replayBody returns body where captured globals are replaced with their values
+func (f *function) replayBody(ir *Interpreter) []*Token {
+	if f.captured == nil {
+		return f.body
+	}
+	body := []*Token{}
+	for _, tok := range f.body {
+		if val, ok := f.captured[tok.Variable]; ok && tok.Type == TokenVariable && !f.isParam(tok.Variable) {
+			body = append(body, ir.literalTokens(val)...)
+			continue
+		}
+		body = append(body, tok)
+	}
+	return body
+}
+
+func (f *function) isParam(name string) bool {
+	for _, param := range f.params {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
+// assignOp returns operator that assigns name without conflict with builtins
+func assignOp(builtin bool) string {
+	if builtin {
+		return ":="
+	}
+	return "="
+}
+
+// Save writes variables and functions as script that restores them
+// captured globals of functions are saved as values in function bodies
+func (ir *Interpreter) Save(output io.Writer) error {
+	buf := bufio.NewWriter(output)
+	if mode, _ := ir.Mode(); mode != ModeFloat {
+		fmt.Fprintf(buf, ";mode %s\n", ir.modeString())
+	}
+	for _, name := range ir.Vars() {
+		fmt.Fprintf(buf, "%s %s %s\n", name, assignOp(ir.isConstant(name)), ir.num.literal(ir.vars[name]))
+	}
+	for _, name := range ir.Funcs() {
+		fn := ir.funcs[name]
+		_, isBuiltin := builtins[name]
+		fmt.Fprintf(buf, "@%s %s (%s): %s\n", name, assignOp(isBuiltin),
+			strings.Join(fn.params, ", "), buildExprFromTokens(fn.replayBody(ir)))
+	}
+	return buf.Flush()
+}
+
+// Load executes script saved with Save
+// replaced variables and functions and failed lines are reported
+func (ir *Interpreter) Load(input io.Reader) (*LoadReport, error) {
+	report := &LoadReport{}
+	t := &tokenizer{reader: bufio.NewReader(input), lines: true}
+	for {
+		sl, err := t.nextLine()
+		if err == EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		line, tokens := sl.line, sl.tokens
+		if sl.err != nil {
+			report.Errors = append(report.Errors, &LineError{line, sl.err})
+			continue
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		// line can have several instructions (a = 1, b = 2)
+		instrs := splitInstructions(tokens)
+		before := make([]string, len(instrs))
+		for i, instr := range instrs {
+			if isAssignment(instr) {
+				before[i] = ir.describe(instr[0])
+			}
+		}
+		results, err := ir.execAll(sl.source, tokens, nil, false)
+		for i, instr := range instrs[:len(results)] {
+			if after := ir.describe(instr[0]); before[i] != "" && before[i] != after {
+				report.Conflicts = append(report.Conflicts,
+					fmt.Sprintf("line %d: %s replaced: %s => %s", line, instr[0], before[i], after))
+			}
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, &LineError{line, err})
+		}
+	}
+}
+
+// describe returns definition of variable or function of token ("" if not defined)
+func (ir *Interpreter) describe(tok *Token) string {
+	switch tok.Type {
+	case TokenVariable:
+		if val, ok := ir.vars[tok.Variable]; ok {
+			return ir.num.literal(val)
+		}
+	case TokenFunction:
+		if fn, ok := ir.funcs[tok.Function]; ok {
+			return fn.String()
+		}
+	}
+	return ""
+}
+
+// SaveFile saves session to file (see Save)
+func (ir *Interpreter) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := ir.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadFile loads session from file (see Load)
+func (ir *Interpreter) LoadFile(path string) (*LoadReport, error) {
+	if err := ir.enterFile(path); err != nil {
+		return nil, err
+	}
+	defer ir.leaveFile(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ir.Load(file)
+}
+
+func (r *LoadReport) String() string {
+	buf := &strings.Builder{}
+	for _, conflict := range r.Conflicts {
+		fmt.Fprintf(buf, "conflict: %s\n", conflict)
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(buf, "error: %v\n", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,123 @@
+package gocalc
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoad(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	for _, instr := range []string{
+		"a = 1 / 3",
+		"b = -2e30",
+		"pi := 3",
+		"rate = -0.5",
+		"@f = (x): x * rate",
+		";bind capture",
+		"@g = (x, y): rate ^ x + @f(y) * pi",
+		"@sqrt := (x): x ^ 0.5",
+		"rate = 2",
+	} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+	ass.NoError(ir.SetVar("inf", math.Inf(-1)))
+
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	ass.Equal("a = 0.3333333333333333\n"+
+		"b = -2e+30\n"+
+		"inf = -1 / 0\n"+
+		"pi := 3\n"+
+		"rate = 2\n"+
+		"@f = (x): x * rate\n"+
+		"@g = (x, y): (-0.5) ^ x + @f(y) * 3\n"+
+		"@sqrt := (x): x ^ 0.5\n", buf.String())
+
+	loaded := NewInterpreter(false, 2)
+	report, err := loaded.Load(strings.NewReader(buf.String()))
+	ass.NoError(err)
+	ass.Empty(report.Conflicts)
+	ass.Empty(report.Errors)
+	ass.Equal(ir.Vars(), loaded.Vars())
+	ass.Equal(ir.Funcs(), loaded.Funcs())
+	for _, expr := range []string{"a", "b", "inf", "@g(2, 3)", "@g(3, 2)", "@sqrt(16)"} {
+		exp, err := ir.Eval(expr)
+		ass.NoError(err)
+		act, err := loaded.Eval(expr)
+		ass.NoError(err)
+		ass.Equal(exp, act, expr)
+	}
+}
+
+func TestLoadReport(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 0)
+	ir.ProcessInstruction("a = 1")
+	ir.ProcessInstruction("b = 2")
+	ir.ProcessInstruction("@f = (x): x")
+
+	report, err := ir.Load(strings.NewReader("a = 1\nb = 3\n@f = (x): -x\nc = (\n$\n"))
+	ass.NoError(err)
+	ass.Equal([]string{
+		"line 2: b replaced: 2 => 3",
+		"line 3: @f replaced: (x): x => (x): -x",
+	}, report.Conflicts)
+	if ass.Len(report.Errors, 2) {
+		ass.Equal(4, report.Errors[0].Line)
+		var perr *Error
+		ass.True(errors.As(report.Errors[1], &perr))
+		ass.Equal("line 5: at index 0: bad token", report.Errors[1].Error())
+	}
+	ass.Equal("conflict: line 2: b replaced: 2 => 3\n"+
+		"conflict: line 3: @f replaced: (x): x => (x): -x\n"+
+		"error: line 4: at index 4: parens not matching\n"+
+		"error: line 5: at index 0: bad token", report.String())
+
+	// instructions of line are executed and reported separately
+	report, err = ir.Load(strings.NewReader("a = 4, d = 5, b = 3\nc = 6, g = 1 +, h = 7\n"))
+	ass.NoError(err)
+	ass.Equal("conflict: line 1: a replaced: 1 => 4\n"+
+		"error: line 2: at index 14: unexpected end of expression", report.String())
+	ass.Equal([]string{"a", "b", "c", "d"}, ir.Vars())
+
+	// session with several instructions in line round-trips
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	loaded := NewInterpreter(false, 0)
+	report, err = loaded.Load(strings.NewReader(strings.ReplaceAll(strings.TrimSuffix(buf.String(), "\n"), "\n", ", ")))
+	ass.NoError(err)
+	ass.Empty(report.Errors)
+	ass.Equal(ir.Vars(), loaded.Vars())
+	ass.Equal(ir.Funcs(), loaded.Funcs())
+}
+
+func TestSaveLoadCommands(t *testing.T) {
+	ass := assert.New(t)
+	path := filepath.Join(t.TempDir(), "session.calc")
+	ir := NewInterpreter(false, 0)
+	ir.ProcessInstruction("x = 42")
+	ir.ProcessInstruction("@sq = (a): a * a")
+
+	ass.Equal("", ir.ProcessInstruction(";save "+path))
+	ass.Equal("error: at index 0: expected file name", ir.ProcessInstruction(";load"))
+
+	loaded := NewInterpreter(false, 0)
+	loaded.ProcessInstruction("x = 1")
+	ass.Equal("conflict: line 1: x replaced: 1 => 42", loaded.ProcessInstruction(";load "+path))
+	ass.Equal("1764", loaded.ProcessInstruction("@sq(x)"))
+
+	// script can't load itself
+	ass.NoError(os.WriteFile(path, []byte("x = x + 1\n;load "+path+"\n"), 0644))
+	ass.Equal("conflict: line 1: x replaced: 42 => 43\n"+
+		"error: line 2: recursive load of "+path, loaded.ProcessInstruction(";load "+path))
+	ass.Equal("43", loaded.ProcessInstruction("x"))
+	ass.Equal("", loaded.ProcessInstruction(";save "+path))
+	ass.Equal("", loaded.ProcessInstruction(";load "+path))
+}
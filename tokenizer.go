@@ -1,10 +1,14 @@
 package gocalc
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"math/big"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Token types
@@ -15,26 +19,45 @@ const (
 	TokenVariable
 	TokenDelimiter
 	TokenMetaCommand
+	TokenBad // skipped bad input, Tokens returns it only with error
 )
 
 // Token (can be one of Token types)
 type Token struct {
-	Pos       int // position in input
+	Pos       int // position in input (byte offset)
+	End       int // position after token in input (byte offset)
+	Line      int // line of token in input (from 0)
+	Col       int // display column of token in line (from 0)
 	Type      int
 	Operator  string
 	Number    float64
+	Literal   string // source text of number (empty if token is not from input), unit of conversion operator
+	Imag      bool   // imaginary number (4i)
 	Variable  string
 	Function  string
+	Argc      int // argument count of function call (set in postfix notation)
+	Jump      int // count of tokens to skip (conditional and logical operators in postfix notation)
 	Delimiter string
 	Command   string
+	// raw arguments of meta command (rest of line after command without comment)
+	CommandArgs string
 }
 
 func (t *Token) String() string {
 	switch t.Type {
 	case TokenNumber:
+		switch {
+		case t.Literal != "":
+			return t.Literal
+		case t.Imag:
+			return fmt.Sprint(t.Number) + "i"
+		}
 		return fmt.Sprint(t.Number)
 
 	case TokenMetaCommand:
+		if t.CommandArgs != "" {
+			return ";" + t.Command + " " + t.CommandArgs
+		}
 		return ";" + t.Command
 
 	case TokenFunction:
@@ -50,7 +73,13 @@ func (t *Token) String() string {
 		if isUnary(t) {
 			return t.Operator[1:]
 		}
+		if sym, ok := opSymbols[t.Operator]; ok {
+			return sym
+		}
 		return t.Operator
+
+	case TokenBad:
+		return "?"
 	}
 
 	return ""
@@ -71,6 +100,11 @@ func Num(num float64) *Token {
 	return &Token{Type: TokenNumber, Number: num}
 }
 
+// Call creates function token with argument count
+func Call(name string, argc int) *Token {
+	return &Token{Type: TokenFunction, Function: name, Argc: argc}
+}
+
 // Var creates variable token
 func Var(name string) *Token {
 	return &Token{Type: TokenVariable, Variable: name}
@@ -101,99 +135,301 @@ type Tokenizer interface {
 }
 
 type tokenizer struct {
-	data      string
-	pos       int
+	data      string // buffered input
+	offset    int    // position of data in input (input before it is dropped)
+	pos       int    // position in data
 	prevToken *Token
+	reader    *bufio.Reader // rest of input (nil if all input is in data)
+	err       error         // error of reader
+	lines     bool          // end of line is delimiter "\n" (lines of script)
+	lineStart int           // position of current line in data, it is kept in lines mode
+	joins     []int         // positions of backslashes of continued lines in input (lines mode)
+	line      int           // line of colPos (from 0)
+	col       int           // display column of colPos
+	colPos    int
 }
 
 // ParseNumber parses float64
 // and returns number and cnt - length of number in bytes
 // if s does not have number as prefix returns cnt = 0
+// supported forms: 12, 1.5, .5, 6.02e23, 1_000, 0x1F, 0b1010, 0o755
+// result is the nearest float64 to the literal (as strconv.ParseFloat)
 func ParseNumber(s string) (num float64, pos int) {
 	if len(s) == 0 {
 		return 0, 0
 	}
-	numLen := 0
-	for pos < len(s) && s[pos] >= '0' && s[pos] <= '9' {
-		numLen++
-		digit := s[pos]
-		num = num*10 + float64(digit-48)
-		pos++
+
+	if len(s) > 2 && s[0] == '0' {
+		base := 0
+		switch s[1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		}
+		if base != 0 {
+			if cnt := scanDigits(s[2:], base); cnt > 0 {
+				digits := strings.ReplaceAll(s[2:2+cnt], "_", "")
+				n, _ := new(big.Int).SetString(digits, base)
+				num, _ = new(big.Float).SetInt(n).Float64()
+				return num, 2 + cnt
+			}
+		}
 	}
 
-	if numLen == 0 {
+	intLen := scanDigits(s, 10)
+	pos = intLen
+	fracLen := 0
+	if pos < len(s) && s[pos] == '.' {
+		fracLen = scanDigits(s[pos+1:], 10)
+		if intLen == 0 && fracLen == 0 {
+			return 0, 0
+		}
+		pos += 1 + fracLen
+	}
+	if intLen == 0 && fracLen == 0 {
 		return 0, 0
 	}
 
-	if pos == len(s) || s[pos] != '.' {
-		return num, pos
+	if pos < len(s) && (s[pos] == 'e' || s[pos] == 'E') {
+		exp := pos + 1
+		if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+			exp++
+		}
+		if cnt := scanDigits(s[exp:], 10); cnt > 0 {
+			pos = exp + cnt
+		}
 	}
-	pos++
 
-	k := 0.1
-	for pos < len(s) && s[pos] >= '0' && s[pos] <= '9' {
-		digit := s[pos]
-		num = num + k*float64(digit-48)
-		k /= 10
+	// out of range literals are parsed as +-Inf (error is ignored)
+	num, _ = strconv.ParseFloat(strings.ReplaceAll(s[:pos], "_", ""), 64)
+	return num, pos
+}
+
+// scanDigits returns length of digits prefix of s in base
+// underscores are allowed between digits
+func scanDigits(s string, base int) int {
+	pos := 0
+	for pos < len(s) {
+		if s[pos] == '_' && pos > 0 && pos+1 < len(s) && isDigit(s[pos+1], base) {
+			pos += 2
+			continue
+		}
+		if !isDigit(s[pos], base) {
+			break
+		}
 		pos++
 	}
+	return pos
+}
 
-	return num, pos
+func isDigit(c byte, base int) bool {
+	var val int
+	switch {
+	case c >= '0' && c <= '9':
+		val = int(c - '0')
+	case c >= 'a' && c <= 'f':
+		val = int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		val = int(c-'A') + 10
+	default:
+		return false
+	}
+	return val < base
 }
 
-// ParseIdentifier parses indetifer
+// ParseIdentifier parses indetifer (letters, digits and underscores, not starting with digit)
+// letters and digits are any unicode letters and digits, combining marks can follow them
 func ParseIdentifier(s string) (identifier string, pos int) {
-	if len(s) == 0 {
+	if r, size := utf8.DecodeRuneInString(s); unicode.IsLetter(r) || r == '_' {
+		pos = size
+	} else {
 		return "", 0
 	}
 
-	if !unicode.IsLetter(rune(s[pos])) {
-		return "", 0
+	for pos < len(s) {
+		r, size := utf8.DecodeRuneInString(s[pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && r != '_' {
+			break
+		}
+		pos += size
 	}
-	pos++
 
-	for pos < len(s) && (unicode.IsLetter(rune(s[pos])) || unicode.IsDigit(rune(s[pos]))) {
-		pos++
+	return s[:pos], pos
+}
+
+// displayWidth returns count of terminal columns taken by s
+// (combining marks take no columns, wide east asian characters take two)
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case isWide(r):
+			width += 2
+		default:
+			width++
+		}
 	}
+	return width
+}
 
-	return s[:pos], pos
+// isWide reports if r takes two columns in terminal
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana) ||
+		r >= 0xFF01 && r <= 0xFF60 || r >= 0xFFE0 && r <= 0xFFE6
 }
 
-func (t *tokenizer) NextToken() (tok *Token, err error) {
-	for t.pos < len(t.data) && t.data[t.pos] == ' ' {
+// advance moves line and column tracking to position in data (not before previous one)
+func (t *tokenizer) advance(pos int) {
+	skipped := t.data[t.colPos:pos]
+	if nl := strings.LastIndexByte(skipped, '\n'); nl >= 0 {
+		t.line += strings.Count(skipped, "\n")
+		t.col, skipped = 0, skipped[nl+1:]
+	}
+	t.col += displayWidth(skipped)
+	t.colPos = pos
+}
+
+// more reads next line of reader to data and reports if something was read,
+// data before current line is dropped
+func (t *tokenizer) more() bool {
+	if t.reader == nil || t.err != nil {
+		return false
+	}
+	if !t.lines {
+		// nothing before current position is needed
+		t.lineStart = t.pos
+	}
+	keep := t.lineStart
+	if keep > t.colPos {
+		t.advance(keep)
+	}
+	t.data = t.data[keep:]
+	t.offset += keep
+	t.pos -= keep
+	t.lineStart -= keep
+	t.colPos -= keep
+
+	line, err := t.reader.ReadString('\n')
+	t.data += line
+	t.err = err
+	return line != ""
+}
+
+// lineLen returns length of first line of s without end of line
+func lineLen(s string) int {
+	if end := strings.IndexByte(s, '\n'); end >= 0 {
+		return end
+	}
+	return len(s)
+}
+
+// skipSpace skips spaces, comments and ends of continued lines,
+// in lines mode end of line is not skipped
+func (t *tokenizer) skipSpace() error {
+	for {
+		if t.pos >= len(t.data) && !t.more() {
+			if t.err != nil && t.err != io.EOF {
+				return t.err
+			}
+			return EOF
+		}
+		switch c := t.data[t.pos]; {
+		case c == '#':
+			// comment till end of line
+			t.pos += lineLen(t.data[t.pos:])
+		case c == '\\' && t.continued():
+		case c == '\n' && t.lines:
+			return nil
+		default:
+			r, size := utf8.DecodeRuneInString(t.data[t.pos:])
+			if !unicode.IsSpace(r) {
+				return nil
+			}
+			t.pos += size
+		}
+	}
+}
+
+// continued skips backslash at end of line with this end of line (spaces and comment can follow backslash)
+func (t *tokenizer) continued() bool {
+	rest := t.data[t.pos+1:]
+	end := lineLen(rest)
+	if code := rest[:end]; strings.TrimSpace(code[:commentStart(code)]) != "" {
+		return false
+	}
+	if t.lines {
+		t.joins = append(t.joins, t.offset+t.pos)
+	}
+	t.pos += 1 + end
+	if t.pos < len(t.data) {
 		t.pos++
 	}
-	if t.pos >= len(t.data) {
-		return nil, EOF
+	return true
+}
+
+func (t *tokenizer) NextToken() (tok *Token, err error) {
+	if err := t.skipSpace(); err != nil {
+		return nil, err
 	}
 	defer func(pos int) {
 		if tok == nil {
 			return
 		}
-		tok.Pos = pos
+		t.advance(pos)
+		tok.Pos = t.offset + pos
+		tok.End = t.offset + t.pos
+		tok.Line, tok.Col = t.line, t.col
 		t.prevToken = tok
 	}(t.pos)
+	if t.data[t.pos] == '\n' {
+		// end of script line
+		t.pos++
+		t.lineStart = t.pos
+		return Delim("\n"), nil
+	}
 	num, cnt := ParseNumber(t.data[t.pos:])
 	if cnt > 0 {
+		tok := Num(num)
+		// imaginary unit suffix, not part of identifier
+		if ident, _ := ParseIdentifier(t.data[t.pos+cnt:]); ident == "i" {
+			tok.Imag = true
+			cnt++
+		}
+		tok.Literal = t.data[t.pos : t.pos+cnt]
 		t.pos += cnt
-		return Num(num), nil
+		return tok, nil
 	}
 
 	op := string(t.data[t.pos])
 	if strings.Contains("+-", op) {
 		t.pos++
-		if t.prevToken != nil && (t.prevToken.Type == TokenVariable ||
-			t.prevToken.Type == TokenNumber ||
-			t.prevToken.Operator == ")") {
-
+		if t.prevToken != nil && endsOperand(t.prevToken) {
 			return Op(op), nil
 		}
 		return UnOp(op), nil
 	}
-	if strings.Contains("/*()=", op) {
+	for _, long := range []string{"//", "**", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||"} {
+		if strings.HasPrefix(t.data[t.pos:], long) {
+			t.pos += 2
+			return Op(long), nil
+		}
+	}
+	if op == "~" || op == "!" {
+		t.pos++
+		return UnOp(op), nil
+	}
+	if strings.Contains("/*()=^%&|<>?", op) {
 		t.pos++
 		return Op(op), nil
 	}
+	if strings.HasPrefix(t.data[t.pos:], ":=") {
+		t.pos += 2
+		return Op(":="), nil
+	}
 	if op == "," || op == ":" {
 		t.pos++
 		return Delim(op), nil
@@ -216,28 +452,79 @@ func (t *tokenizer) NextToken() (tok *Token, err error) {
 			return Func(identifier), nil
 		}
 		if ismeta {
-			return Meta(identifier), nil
+			meta := Meta(identifier)
+			end := lineLen(t.data[t.pos:])
+			args := t.data[t.pos : t.pos+end]
+			meta.CommandArgs = strings.TrimSpace(args[:commentStart(args)])
+			t.pos += end
+			return meta, nil
 		}
 		return Var(identifier), nil
 	}
-	return nil, indexedError{initial, "bad token"}
+	// bad character is skipped, so tokenizing can go on
+	_, size := utf8.DecodeRuneInString(t.data[initial:])
+	t.pos = initial + size
+	return nil, spanError(t.offset+initial, t.offset+t.pos, "bad token")
+
+}
 
+// commentStart returns position of # comment in line (length of line if it has no comment),
+// # in double quotes is not comment
+func commentStart(line string) int {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return len(line)
 }
 
+// Tokens returns all tokens of input
+// bad tokens are reported together as ErrorList,
+// tokens are returned with TokenBad in place of them
 func (t *tokenizer) Tokens() ([]*Token, error) {
-	res := []*Token{}
+	res, _, err := t.collect()
+	return res, err
+}
+
+// collect returns tokens till end of input (or till end of line in lines mode),
+// end reports if input is over
+func (t *tokenizer) collect() (res []*Token, end bool, err error) {
+	res = []*Token{}
+	errs := ErrorList{}
 	for {
 		token, err := t.NextToken()
 		if err == EOF {
-			break
+			return res, true, errs.Err()
 		}
 		if err != nil {
-			return nil, err
+			perr, ok := err.(*Error)
+			if !ok {
+				return nil, true, err
+			}
+			// run of bad characters is one bad token
+			if last := len(res) - 1; last >= 0 && res[last].Type == TokenBad && res[last].End == perr.Pos {
+				res[last].End = perr.End
+				errs[len(errs)-1].End = perr.End
+				continue
+			}
+			errs = append(errs, perr)
+			t.advance(perr.Pos - t.offset)
+			res = append(res, &Token{Type: TokenBad, Pos: perr.Pos, End: perr.End, Line: t.line, Col: t.col})
+			t.prevToken = res[len(res)-1]
+			continue
+		}
+		if token.Type == TokenDelimiter && token.Delimiter == "\n" {
+			return res, false, errs.Err()
 		}
 		res = append(res, token)
 	}
-
-	return res, nil
 }
 
 // NewStringTokenizer returns tokenizer for tokenize data string
@@ -247,14 +534,33 @@ func NewStringTokenizer(data string) Tokenizer {
 	}
 }
 
+// NewReaderTokenizer returns tokenizer that reads input line by line when it needs more tokens
+// (positions of tokens are counted from start of input, lines can be of any length)
+func NewReaderTokenizer(input io.Reader) Tokenizer {
+	return &tokenizer{
+		reader: bufio.NewReader(input),
+	}
+}
+
 func buildExprFromTokens(tokens []*Token) string {
 	buf := &strings.Builder{}
 	for _, tok := range tokens {
+		if tok.Operator == "mul" {
+			// implicit multiplication of unit mode
+			buf.WriteString(" ")
+			continue
+		}
 		if tok.Type == TokenOperator && !isUnary(tok) && !strings.Contains("()", tok.Operator) {
 			fmt.Fprintf(buf, " %s ", tok)
 			continue
 		}
 
+		if tok.Type == TokenDelimiter && tok.Delimiter == ":" {
+			// else branch of conditional operator
+			fmt.Fprintf(buf, " %s ", tok)
+			continue
+		}
+
 		if tok.Type == TokenDelimiter {
 			fmt.Fprintf(buf, "%s ", tok)
 			continue
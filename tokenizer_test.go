@@ -2,7 +2,9 @@ package gocalc
 
 import (
 	"math"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -179,6 +181,19 @@ func TestTokenizer(t *testing.T) {
 				Var("a"), Op("="), Num(2), Op("+"), Num(2),
 			},
 		},
+		{
+			expr: "a^-2 % 3//4/5",
+			expected: []*Token{
+				Var("a"), Op("^"), UnOp("-"), Num(2), Op("%"), Num(3), Op("//"), Num(4), Op("/"), Num(5),
+			},
+		},
+		{
+			expr: "a<=1&&!b||c!=-2?a>b:a==b",
+			expected: []*Token{
+				Var("a"), Op("<="), Num(1), Op("&&"), UnOp("!"), Var("b"), Op("||"), Var("c"), Op("!="), UnOp("-"), Num(2),
+				Op("?"), Var("a"), Op(">"), Var("b"), Delim(":"), Var("a"), Op("=="), Var("b"),
+			},
+		},
 		{
 			expr: "@sum = (a, b): a + b", // function
 			expected: []*Token{
@@ -236,3 +251,254 @@ func TestTokenizer(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenizerErrors(t *testing.T) {
+	ass := assert.New(t)
+	tokens, err := NewStringTokenizer("1 $$ + x ` 2 @").Tokens()
+	errs, ok := err.(ErrorList)
+	if !ass.True(ok) || !ass.Len(errs, 3) {
+		return
+	}
+	ass.Equal(Error{Pos: 2, End: 4, Msg: "bad token"}, *errs[0])
+	ass.Equal(Error{Pos: 9, End: 10, Msg: "bad token"}, *errs[1])
+	ass.Equal(Error{Pos: 13, End: 14, Msg: "bad token"}, *errs[2])
+
+	types := []int{}
+	for _, tok := range tokens {
+		types = append(types, tok.Type)
+	}
+	ass.Equal([]int{TokenNumber, TokenBad, TokenOperator, TokenVariable, TokenBad, TokenNumber, TokenBad}, types)
+}
+
+func TestImaginaryLiteral(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		expr string
+		imag []bool
+	}{
+		{"3+4i", []bool{false, false, true}},
+		{"2.5e1i * i", []bool{true, false, false}},
+		{"0x1Fi", []bool{true}},
+		{"4 in", []bool{false, false}},
+	}
+	for _, test := range tests {
+		tokens, err := NewStringTokenizer(test.expr).Tokens()
+		if !ass.NoError(err, test.expr) || !ass.Len(tokens, len(test.imag), test.expr) {
+			continue
+		}
+		for i, tok := range tokens {
+			ass.Equal(test.imag[i], tok.Imag, test.expr)
+		}
+	}
+
+	tokens, _ := NewStringTokenizer("3+4i").Tokens()
+	ass.Equal("3 + 4i", buildExprFromTokens(tokens))
+	ass.EqualValues(4, tokens[2].Number)
+}
+
+func TestBuildExprFromTokens(t *testing.T) {
+	ass := assert.New(t)
+	tests := []string{
+		"2 + 3 * -x",
+		"-2 ^ 2 % 3 // 4",
+		"@f(a, -(b - 1)) / 2",
+	}
+
+	for _, test := range tests {
+		tokens, err := NewStringTokenizer(test).Tokens()
+		ass.NoError(err)
+		ass.Equal(test, buildExprFromTokens(tokens))
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input string
+		num   float64
+		cnt   int
+	}{
+		{"12", 12, 2},
+		{"12.5+", 12.5, 4},
+		{"5.", 5, 2},
+		{".5", 0.5, 2},
+		{"0.1", 0.1, 3},
+		{"0.3", 0.3, 3},
+		{"123456789.987654321", 123456789.987654321, 19},
+		{"1e-9", 1e-9, 4},
+		{"6.022e23", 6.022e23, 8},
+		{"1E+3*", 1000, 4},
+		{"2e", 2, 1},
+		{"2e+x", 2, 1},
+		{"1_000_000", 1000000, 9},
+		{"1__0", 1, 1},
+		{"1_", 1, 1},
+		{"0x1F", 31, 4},
+		{"0XfF_fF", 65535, 7},
+		{"0b1010", 10, 6},
+		{"0b102", 2, 4},
+		{"0o755", 493, 5},
+		{"0x", 0, 1},
+		{"0xg", 0, 1},
+		{"1e999", math.Inf(1), 5},
+		{".", 0, 0},
+		{"a1", 0, 0},
+		{"", 0, 0},
+	}
+
+	for _, test := range tests {
+		num, cnt := ParseNumber(test.input)
+		ass.Equal(test.num, num, test.input)
+		ass.Equal(test.cnt, cnt, test.input)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input, identifier string
+	}{
+		{"α = 2", "α"},
+		{"Δt*2", "Δt"},
+		{"température", "température"},
+		{"éte", "éte"},
+		{"_x1₂", "_x1"},
+		{"x٣ + 1", "x٣"},
+		{"1α", ""},
+		{"́e", ""},
+		{"€", ""},
+	}
+	for _, test := range tests {
+		identifier, pos := ParseIdentifier(test.input)
+		ass.Equal(test.identifier, identifier, test.input)
+		ass.Equal(len(test.identifier), pos, test.input)
+	}
+
+	tokens, err := NewStringTokenizer("Δt\t* (température + π)").Tokens()
+	ass.NoError(err)
+	pos, cols := []int{}, []int{}
+	for _, tok := range tokens {
+		pos = append(pos, tok.Pos)
+		cols = append(cols, tok.Col)
+	}
+	ass.Equal([]int{0, 4, 6, 7, 20, 22, 24}, pos)
+	ass.Equal([]int{0, 3, 5, 6, 18, 20, 21}, cols)
+
+	tokens, err = NewStringTokenizer("日本 € 1").Tokens()
+	ass.Error(err)
+	if ass.Len(tokens, 3) {
+		ass.Equal(TokenBad, tokens[1].Type)
+		ass.Equal([]int{7, 10, 5}, []int{tokens[1].Pos, tokens[1].End, tokens[1].Col})
+		ass.Equal(7, tokens[2].Col)
+	}
+}
+
+func TestComments(t *testing.T) {
+	ass := assert.New(t)
+	tokens, err := NewStringTokenizer("1 + # one\n2#two").Tokens()
+	ass.NoError(err)
+	ass.Equal("1 + 2", buildExprFromTokens(tokens))
+
+	tokens, err = NewStringTokenizer("# nothing").Tokens()
+	ass.NoError(err)
+	ass.Empty(tokens)
+
+	tokens, err = NewStringTokenizer(`;save "a#b.calc" # session`).Tokens()
+	if ass.NoError(err) && ass.Len(tokens, 1) {
+		ass.Equal(`"a#b.calc"`, tokens[0].CommandArgs)
+	}
+}
+
+func TestReaderTokenizer(t *testing.T) {
+	ass := assert.New(t)
+	input := "a = 1 # one\n" +
+		"\n" +
+		"  @f(α, \\\n" +
+		" $) + 2\n" +
+		"b"
+	tokens, err := NewReaderTokenizer(strings.NewReader(input)).Tokens()
+	ass.Equal([]error{&Error{Pos: 25, End: 26, Msg: "bad token"}}, Errors(err))
+
+	strTokens, strErr := NewStringTokenizer(input).Tokens()
+	ass.Equal(strErr, err)
+	ass.Equal(strTokens, tokens)
+
+	type position struct{ pos, line, col int }
+	positions := []position{}
+	for _, tok := range tokens {
+		positions = append(positions, position{tok.Pos, tok.Line, tok.Col})
+	}
+	ass.Equal([]position{
+		{0, 0, 0}, {2, 0, 2}, {4, 0, 4},
+		{15, 2, 2}, {17, 2, 4}, {18, 2, 5}, {20, 2, 6},
+		{25, 3, 1}, {26, 3, 2}, {28, 3, 4}, {30, 3, 6},
+		{32, 4, 0},
+	}, positions)
+
+	// lines are not limited
+	long := strings.Repeat("1 + ", 40000) + "1\n2"
+	tk := NewReaderTokenizer(strings.NewReader(long))
+	count := 0
+	for {
+		tok, err := tk.NextToken()
+		if err == EOF {
+			break
+		}
+		if !ass.NoError(err) {
+			break
+		}
+		count++
+		if tok.Line == 1 {
+			ass.Equal(len(long)-1, tok.Pos)
+			ass.Equal(0, tok.Col)
+		}
+	}
+	ass.Equal(80002, count)
+
+	_, err = NewReaderTokenizer(iotest.TimeoutReader(strings.NewReader("1 + 2\n3"))).Tokens()
+	ass.Equal(iotest.ErrTimeout, err)
+}
+
+func TestImplicitTokens(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input, output string
+	}{
+		{"2x", "2 * x"},
+		{"3(a+b)", "3 * (a + b)"},
+		{"(a+b)(a-b)", "(a + b) * (a - b)"},
+		{"2@f(x)", "2 * @f(x)"},
+		{"@f(x)@g(y)", "@f(x) * @g(y)"},
+		{"@f(2x)y", "@f(2 * x) * y"},
+		{"x y z", "x * y * z"},
+		{"x(y)", "x * (y)"},
+		{"2x^2", "2 * x ^ 2"},
+		{"-2x", "-2 * x"},
+		{"1/2x", "1 / 2 * x"},
+		{"2e", "2 * e"},
+		{"2e3x", "2e3 * x"},
+		{"0x1Fx", "0x1F * x"},
+		{"1_000m", "1_000 * m"},
+		{"2i", "2i"},
+		{"2i x", "2i * x"},
+		{"2ix", "2 * ix"},
+		{"2 3", "23"},
+		{"x 2", "x2"},
+		{"(a)2", "(a)2"},
+		{"2 - x", "2 - x"},
+		{"a ? 2b : c", "a ? 2 * b : c"},
+		{"@f(1, 2)", "@f(1, 2)"},
+	}
+	for _, test := range tests {
+		tokens, err := NewStringTokenizer(test.input).Tokens()
+		if !ass.NoError(err, test.input) {
+			continue
+		}
+		ass.Equal(test.output, buildExprFromTokens(implicitTokens(tokens, "*")), test.input)
+	}
+
+	// inserted operator points to right operand
+	tokens, _ := NewStringTokenizer("12 (x)").Tokens()
+	mul := implicitTokens(tokens, "*")[1]
+	ass.Equal([]int{3, 3, 3}, []int{mul.Pos, mul.End, mul.Col})
+}
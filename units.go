@@ -0,0 +1,482 @@
+package gocalc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Dimension is exponents of SI base units (m, kg, s, A, K, mol, cd) in unit of quantity
+type Dimension [7]int
+
+// indexes of base units in Dimension
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimCurrent
+	dimTemperature
+	dimAmount
+	dimLuminosity
+)
+
+// baseUnits are SI units of dimensions
+var baseUnits = [...]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+
+// Quantity is value of unit mode: number with physical dimension
+type Quantity struct {
+	Num   float64 // value in SI units
+	Dim   Dimension
+	Unit  string  // unit of output, empty for SI units
+	Scale float64 // value of Unit in SI units
+}
+
+type unit struct {
+	scale    float64 // value in SI units
+	dim      Dimension
+	prefixed bool // SI prefixes can be used with unit
+}
+
+// units are units of unit mode, they are constants of that mode
+// (inch is not in, because in is conversion operator)
+var units = map[string]unit{
+	// SI base units (kg is prefixed gram)
+	"m":   {1, Dimension{dimLength: 1}, true},
+	"g":   {1e-3, Dimension{dimMass: 1}, true},
+	"s":   {1, Dimension{dimTime: 1}, true},
+	"A":   {1, Dimension{dimCurrent: 1}, true},
+	"K":   {1, Dimension{dimTemperature: 1}, true},
+	"mol": {1, Dimension{dimAmount: 1}, true},
+	"cd":  {1, Dimension{dimLuminosity: 1}, true},
+	// derived SI units
+	"Hz":  {1, Dimension{dimTime: -1}, true},
+	"N":   {1, Dimension{dimLength: 1, dimMass: 1, dimTime: -2}, true},
+	"Pa":  {1, Dimension{dimLength: -1, dimMass: 1, dimTime: -2}, true},
+	"J":   {1, Dimension{dimLength: 2, dimMass: 1, dimTime: -2}, true},
+	"W":   {1, Dimension{dimLength: 2, dimMass: 1, dimTime: -3}, true},
+	"C":   {1, Dimension{dimTime: 1, dimCurrent: 1}, true},
+	"V":   {1, Dimension{dimLength: 2, dimMass: 1, dimTime: -3, dimCurrent: -1}, true},
+	"Ω":   {1, Dimension{dimLength: 2, dimMass: 1, dimTime: -3, dimCurrent: -2}, true},
+	"ohm": {1, Dimension{dimLength: 2, dimMass: 1, dimTime: -3, dimCurrent: -2}, true},
+	// other metric units
+	"L":   {1e-3, Dimension{dimLength: 3}, true},
+	"l":   {1e-3, Dimension{dimLength: 3}, true},
+	"t":   {1e3, Dimension{dimMass: 1}, false},
+	"min": {60, Dimension{dimTime: 1}, false},
+	"h":   {3600, Dimension{dimTime: 1}, false},
+	"day": {86400, Dimension{dimTime: 1}, false},
+	"bar": {1e5, Dimension{dimLength: -1, dimMass: 1, dimTime: -2}, true},
+	"atm": {101325, Dimension{dimLength: -1, dimMass: 1, dimTime: -2}, false},
+	"Wh":  {3600, Dimension{dimLength: 2, dimMass: 1, dimTime: -2}, true},
+	"cal": {4.184, Dimension{dimLength: 2, dimMass: 1, dimTime: -2}, true},
+	"eV":  {1.602176634e-19, Dimension{dimLength: 2, dimMass: 1, dimTime: -2}, true},
+	// imperial and US units
+	"inch": {0.0254, Dimension{dimLength: 1}, false},
+	"ft":   {0.3048, Dimension{dimLength: 1}, false},
+	"yd":   {0.9144, Dimension{dimLength: 1}, false},
+	"mi":   {1609.344, Dimension{dimLength: 1}, false},
+	"nmi":  {1852, Dimension{dimLength: 1}, false},
+	"oz":   {0.028349523125, Dimension{dimMass: 1}, false},
+	"lb":   {0.45359237, Dimension{dimMass: 1}, false},
+	"gal":  {3.785411784e-3, Dimension{dimLength: 3}, false},
+	"mph":  {0.44704, Dimension{dimLength: 1, dimTime: -1}, false},
+	"kn":   {1852.0 / 3600, Dimension{dimLength: 1, dimTime: -1}, false},
+	"lbf":  {4.4482216152605, Dimension{dimLength: 1, dimMass: 1, dimTime: -2}, false},
+	"psi":  {6894.757293168361, Dimension{dimLength: -1, dimMass: 1, dimTime: -2}, false},
+	"hp":   {745.6998715822702, Dimension{dimLength: 2, dimMass: 1, dimTime: -3}, false},
+	"BTU":  {1055.05585262, Dimension{dimLength: 2, dimMass: 1, dimTime: -2}, false},
+}
+
+// siPrefixes are prefixes of units (km, µs)
+var siPrefixes = []struct {
+	symbol string
+	scale  float64
+}{
+	{"Y", 1e24}, {"Z", 1e21}, {"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9}, {"M", 1e6},
+	{"k", 1e3}, {"h", 1e2}, {"da", 1e1}, {"d", 1e-1}, {"c", 1e-2}, {"m", 1e-3},
+	{"µ", 1e-6}, {"μ", 1e-6}, {"u", 1e-6}, {"n", 1e-9}, {"p", 1e-12}, {"f", 1e-15},
+	{"a", 1e-18}, {"z", 1e-21}, {"y", 1e-24},
+}
+
+// derivedUnits are named SI units used in output instead of products of base units
+var derivedUnits = []string{"N", "Pa", "J", "W", "C", "V", "Ω"}
+
+// lookupUnit finds unit by name, names of units without their own names are SI prefix and unit (km)
+func lookupUnit(name string) (unit, bool) {
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	for _, prefix := range siPrefixes {
+		if !strings.HasPrefix(name, prefix.symbol) {
+			continue
+		}
+		if u, ok := units[name[len(prefix.symbol):]]; ok && u.prefixed {
+			u.scale *= prefix.scale
+			return u, true
+		}
+	}
+	return unit{}, false
+}
+
+// Units returns sorted names of units of unit mode (without prefixed names)
+func Units() []string {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns dimension as product of SI base units (m*kg/s^2), empty for dimensionless
+func (d Dimension) String() string {
+	var num, den []string
+	for i, exp := range d {
+		switch {
+		case exp > 0:
+			num = append(num, unitPower(baseUnits[i], exp))
+		case exp < 0:
+			den = append(den, unitPower(baseUnits[i], -exp))
+		}
+	}
+	res := strings.Join(num, "*")
+	switch {
+	case len(den) == 0:
+		return res
+	case len(num) == 0:
+		res = "1"
+	}
+	if len(den) > 1 {
+		return res + "/(" + strings.Join(den, "*") + ")"
+	}
+	return res + "/" + den[0]
+}
+
+// unit returns name of SI unit of dimension for output
+func (d Dimension) unit() string {
+	for _, name := range derivedUnits {
+		if units[name].dim == d {
+			return name
+		}
+	}
+	return d.String()
+}
+
+func unitPower(name string, exp int) string {
+	if exp == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s^%d", name, exp)
+}
+
+// dimensionless reports if quantity is number without dimension
+func (q Quantity) dimensionless() bool {
+	return q.Dim == Dimension{}
+}
+
+// plain reports if quantity is number without unit
+func (q Quantity) plain() bool {
+	return q.Unit == "" && q.dimensionless()
+}
+
+// unitName returns unit of output ("" for dimensionless numbers)
+func (q Quantity) unitName() string {
+	if q.Unit != "" {
+		return q.Unit
+	}
+	return q.Dim.unit()
+}
+
+// value returns number of quantity in unit of output
+func (q Quantity) value() float64 {
+	if q.Unit != "" {
+		return q.Num / q.Scale
+	}
+	return q.Num
+}
+
+// withValue returns quantity with number f in unit of output
+func (q Quantity) withValue(f float64) Quantity {
+	if q.Unit != "" {
+		f *= q.Scale
+	}
+	q.Num = f
+	return q
+}
+
+// withUnit returns quantity with unit of output of other quantity
+func (q Quantity) withUnit(other Quantity) Quantity {
+	q.Unit, q.Scale = other.Unit, other.Scale
+	return q
+}
+
+func describeUnit(q Quantity) string {
+	if q.plain() {
+		return "dimensionless"
+	}
+	return q.unitName()
+}
+
+// dimError reports operands of different dimensions
+func dimError(a, b Quantity) error {
+	return fmt.Errorf("incompatible units %s and %s", describeUnit(a), describeUnit(b))
+}
+
+// unitNumeric is arithmetic of unit mode, values are Quantity,
+// numbers are calculated like in float mode, units are constants of mode
+type unitNumeric struct {
+	style int // format of output
+}
+
+func (unitNumeric) mode() (string, uint) {
+	return ModeUnit, 0
+}
+
+func (unitNumeric) number(tok *Token) (Value, error) {
+	if tok.Imag {
+		return nil, errImag
+	}
+	return Quantity{Num: tok.Number}, nil
+}
+
+func (unitNumeric) convert(v Value) (Value, error) {
+	switch v := v.(type) {
+	case Quantity:
+		return v, nil
+	case complex128:
+		if imag(v) != 0 {
+			return nil, errNotReal
+		}
+	}
+	return Quantity{Num: toFloat64(v)}, nil
+}
+
+// float returns number of quantity in unit of output
+func (unitNumeric) float(v Value) float64 {
+	return v.(Quantity).value()
+}
+
+func (unitNumeric) truth(v Value) bool {
+	return v.(Quantity).Num != 0
+}
+
+func (unitNumeric) constant(name string) (Value, bool) {
+	if val, ok := constants[name]; ok {
+		return Quantity{Num: val}, true
+	}
+	u, ok := lookupUnit(name)
+	if !ok {
+		return nil, false
+	}
+	return Quantity{Num: u.scale, Dim: u.dim, Unit: name, Scale: u.scale}, true
+}
+
+func (unitNumeric) unary(op string, a Value) (Value, error) {
+	q := a.(Quantity)
+	switch op {
+	case "u+":
+		return q, nil
+	case "u-":
+		q.Num = -q.Num
+		return q, nil
+	}
+	return nil, opError(op)
+}
+
+// binary keeps unit of output of left operand in sums
+// and unit of quantity multiplied or divided by plain number,
+// other results are in SI units
+func (unitNumeric) binary(op string, a, b Value) (Value, error) {
+	x, y := a.(Quantity), b.(Quantity)
+	switch op {
+	case "*", "/":
+		sign := 1
+		if op == "/" {
+			sign = -1
+		}
+		res, _ := applyOperator(op, x.Num, y.Num)
+		q := Quantity{Num: res}
+		for i := range q.Dim {
+			q.Dim[i] = x.Dim[i] + sign*y.Dim[i]
+		}
+		switch {
+		case y.plain():
+			q = q.withUnit(x)
+		case x.plain() && op == "*":
+			q = q.withUnit(y)
+		}
+		return q, nil
+	case "^", "**":
+		if !y.dimensionless() {
+			return nil, fmt.Errorf("exponent has unit %s", y.unitName())
+		}
+		q := Quantity{Num: math.Pow(x.Num, y.Num)}
+		for i, exp := range x.Dim {
+			p := float64(exp) * y.Num
+			if p != math.Trunc(p) {
+				return nil, fmt.Errorf("fractional power of %s", x.unitName())
+			}
+			q.Dim[i] = int(p)
+		}
+		return q, nil
+	case "//":
+		if x.Dim != y.Dim {
+			return nil, dimError(x, y)
+		}
+		return Quantity{Num: math.Floor(x.Num / y.Num)}, nil
+	}
+	res, ok := applyOperator(op, x.Num, y.Num)
+	if !ok {
+		return nil, opError(op)
+	}
+	if x.Dim != y.Dim {
+		return nil, dimError(x, y)
+	}
+	if compareOps[op] {
+		return Quantity{Num: res}, nil
+	}
+	return Quantity{Num: res, Dim: x.Dim}.withUnit(x), nil
+}
+
+// to converts quantity a to unit of quantity b, unit is name of that unit
+func (unitNumeric) to(a, b Value, unit string) (Value, error) {
+	x, y := a.(Quantity), b.(Quantity)
+	if x.Dim != y.Dim {
+		return nil, fmt.Errorf("can't convert %s to %s", describeUnit(x), unit)
+	}
+	if y.plain() || y.Num == 0 || math.IsInf(y.Num, 0) || math.IsNaN(y.Num) {
+		return nil, fmt.Errorf("bad unit %s", unit)
+	}
+	x.Unit, x.Scale = unit, y.Num
+	return x, nil
+}
+
+// keepUnitBuiltins are builtins applied to number in unit of output of argument
+var keepUnitBuiltins = map[string]bool{
+	"abs": true, "floor": true, "ceil": true, "round": true, "trunc": true,
+	"re": true, "im": true, "conj": true,
+}
+
+// sameUnitBuiltins are builtins of arguments with same dimension,
+// result has unit of first argument (sign and atan2 give numbers)
+var sameUnitBuiltins = map[string]bool{
+	"min": true, "max": true, "hypot": true, "sign": true, "atan2": true,
+}
+
+// call calculates builtin with arguments without dimension,
+// functions of quantities with any dimension are sqrt, keepUnitBuiltins and sameUnitBuiltins
+func (unitNumeric) call(name string, args []Value) (Value, error) {
+	qs := make([]Quantity, len(args))
+	floats := make([]float64, len(args))
+	for i, arg := range args {
+		qs[i] = arg.(Quantity)
+		floats[i] = qs[i].Num
+	}
+	first := qs[0]
+	switch {
+	case name == "sqrt":
+		q := Quantity{Num: math.Sqrt(first.Num)}
+		for i, exp := range first.Dim {
+			if exp%2 != 0 {
+				return nil, fmt.Errorf("@sqrt of %s", first.unitName())
+			}
+			q.Dim[i] = exp / 2
+		}
+		return q, nil
+	case keepUnitBuiltins[name]:
+		return first.withValue(builtins[name].fn([]float64{first.value()})), nil
+	case sameUnitBuiltins[name]:
+		for _, q := range qs[1:] {
+			if q.Dim != first.Dim {
+				return nil, dimError(first, q)
+			}
+		}
+		res := builtins[name].fn(floats)
+		if name == "sign" || name == "atan2" {
+			return Quantity{Num: res}, nil
+		}
+		return Quantity{Num: res, Dim: first.Dim}.withUnit(first), nil
+	}
+	for _, q := range qs {
+		if !q.dimensionless() {
+			return nil, fmt.Errorf("@%s needs arguments without units", name)
+		}
+	}
+	return Quantity{Num: builtins[name].fn(floats)}, nil
+}
+
+// format formats number in unit of output with unit
+func (m unitNumeric) format(v Value, precision int) string {
+	q := v.(Quantity)
+	num := formatFloat(q.value(), m.style, precision)
+	if unit := q.unitName(); unit != "" {
+		return num + " " + unit
+	}
+	return num
+}
+
+// literal is number in SI units multiplied by them and converted to unit of output (3000 * m to km)
+func (unitNumeric) literal(v Value) string {
+	q := v.(Quantity)
+	lit := formatLiteral(q.Num)
+	if !q.dimensionless() {
+		lit += " * " + q.Dim.String()
+	}
+	if q.Unit != "" {
+		lit += " to " + q.Unit
+	}
+	return lit
+}
+
+func (unitNumeric) warnings() []string {
+	return nil
+}
+
+// isUnitMode reports if interpreter is in unit mode
+func (ir *Interpreter) isUnitMode() bool {
+	_, ok := ir.num.(unitNumeric)
+	return ok
+}
+
+// convertUnit calculates conversion operator tok (to, in) in unit mode
+func (ir *Interpreter) convertUnit(tok *Token, a, b Value) (Value, error) {
+	num, ok := ir.num.(unitNumeric)
+	if !ok {
+		return nil, opError(tok.Operator)
+	}
+	return num.to(a, b, tok.Literal)
+}
+
+// unitText returns source of unit operand of conversion operator without spaces around operators (m/s, kg m)
+func unitText(n *Node) string {
+	buf := &strings.Builder{}
+	for _, tok := range n.Infix() {
+		if tok.Operator == "mul" {
+			buf.WriteString(" ")
+			continue
+		}
+		buf.WriteString(tok.String())
+	}
+	return buf.String()
+}
+
+func cmdUnits(ir *Interpreter, args []string) (string, error) {
+	if len(args) > 0 {
+		return "", errors.New("unexpected arguments")
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintln(buf, "units (SI prefixes Y Z E P T G M k h da d c m µ u n p f a z y):")
+	num := unitNumeric{style: FormatAuto}
+	for _, name := range Units() {
+		u := units[name]
+		prefixed := ""
+		if u.prefixed {
+			prefixed = "\t[prefixed]"
+		}
+		q := Quantity{Num: u.scale, Dim: u.dim}
+		fmt.Fprintf(buf, "%s\t= %s%s\n", name, num.format(q, 0), prefixed)
+	}
+	return buf.String(), nil
+}
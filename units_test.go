@@ -0,0 +1,211 @@
+package gocalc
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnits(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	ass.NoError(ir.SetMode(ModeUnit, 0))
+	tests := []struct {
+		input, output string
+	}{
+		{"3 km + 200 m", "3.20 km"},
+		{"200 m + 3 km", "3200.00 m"},
+		{"9.81 m/s^2 * 70 kg", "686.70 N"},
+		{"60 mph to m/s", "26.82 m/s"},
+		{"60 mph in km/h", "96.56 km/h"},
+		{"10 km / 2 km", "5.00"},
+		{"1 / 2 s", "0.50 1/s"},
+		{"2 A * 3 s", "6.00 C"},
+		{"3 m * 2 m to cm^2", "60000.00 cm^2"},
+		{"1 kg m^2 / s^2 to J", "1.00 J"},
+		{"5 kg / (2 m * 1 s^2)", "2.50 Pa"},
+		{"1 W / 1 A / 1 A", "1.00 Ω"},
+		{"2 kg / 1 mol", "2.00 kg/mol"},
+		{"1 mol / (1 m^3 * 1 s)", "1.00 mol/(m^3*s)"},
+		{"1 inch to cm", "2.54 cm"},
+		{"1 mi to ft", "5280.00 ft"},
+		{"1 lb to g", "453.59 g"},
+		{"1 gal to L", "3.79 L"},
+		{"1 atm to bar", "1.01 bar"},
+		{"1 kWh to MJ", "3.60 MJ"},
+		{"1 µs + 1 ns", "1.00 µs"},
+		{"1 day to min", "1440.00 min"},
+		{"-2 m * 3", "-6.00 m"},
+		{"1.5 km * 2 / 3", "1.00 km"},
+		{"2 pi m", "6.28 m"},
+		{"(2 m)^2", "4.00 m^2"},
+		{"@sqrt(16 m^2)", "4.00 m"},
+		{"@round(3.6 km)", "4.00 km"},
+		{"@min(1 km, 500 m)", "0.50 km"},
+		{"@hypot(3 m, 4 m)", "5.00 m"},
+		{"@atan2(1 m, 1 m) to 1", "error: at index 17: bad unit 1"},
+		{"2 m < 3 ft", "0.00"},
+		{"1 km == 1000 m", "1.00"},
+		{"7 m // 2 m", "3.00"},
+		{"7 m % 2 m", "1.00 m"},
+		{"1 m ? 2 s : 3 s", "2.00 s"},
+		{"1 m + 1 s", "error: at index 4: incompatible units m and s"},
+		{"1 km - 1", "error: at index 5: incompatible units km and dimensionless"},
+		{"1 m < 1 kg", "error: at index 4: incompatible units m and kg"},
+		{"60 mph to kg", "error: at index 7: can't convert mph to kg"},
+		{"2 to km", "error: at index 2: can't convert dimensionless to km"},
+		{"2 m to 0 m", "error: at index 4: bad unit 0 m"},
+		{"(2 m)^0.5", "error: at index 5: fractional power of m"},
+		{"2 ^ (1 m)", "error: at index 2: exponent has unit m"},
+		{"2 ^ 1 m", "2.00 m"},
+		{"@sqrt(2 m)", "error: at index 0: call @sqrt: @sqrt of m"},
+		{"@sin(1 m)", "error: at index 0: call @sin: @sin needs arguments without units"},
+		{"@sin(1 m / 1 km)", "0.00"},
+		{"1 furlong", "error: at index 2: unknown variable: furlong"},
+		{"m = 2", "error: at index 0: m is constant (use := to override)"},
+		{"km = 2", "error: at index 0: km is constant (use := to override)"},
+		{"d = 42 km", ""},
+		{"d / 2 h", "5.83 m/s"},
+		{"d / 2 h to km/h", "21.00 km/h"},
+		{"@speed = (d, t): d / t to km/h", ""},
+		{"@speed(100 m, 9.58 s)", "37.58 km/h"},
+		{";funcs", "functions:\n@speed\t= (d, t): d / t to km / h\t[uses: h, km]"},
+	}
+	for _, test := range tests {
+		ass.Equal(test.output, ir.ProcessInstruction(test.input), test.input)
+	}
+
+	// result value is number in unit of output
+	res, err := ir.Exec("100 km/h to mph")
+	ass.NoError(err)
+	ass.InDelta(62.137, res.Value, 1e-3)
+	ass.Equal(Quantity{Num: 100 / 3.6, Dim: Dimension{dimLength: 1, dimTime: -1}, Unit: "mph", Scale: 0.44704}, res.Number)
+}
+
+func TestConversionOperator(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		input, output string
+	}{
+		{"5 m to ft", "5 * m to ft"},
+		{"x in inch", "x in inch"},
+		{"(a) to b", "(a) to b"},
+		{"to + in", "to + in"},
+		{"a + to", "a + to"},
+	}
+	for _, test := range tests {
+		tokens, err := NewStringTokenizer(test.input).Tokens()
+		if !ass.NoError(err, test.input) {
+			continue
+		}
+		ass.Equal(test.output, buildExprFromTokens(implicitTokens(conversionTokens(tokens), "*")), test.input)
+	}
+
+	// conversion has lowest priority, implicit multiplication of unit mode binds tighter than / and *
+	ir := NewInterpreter(false, 2)
+	ass.NoError(ir.SetMode(ModeUnit, 0))
+	tokens, _ := NewStringTokenizer("a + 1/2 b to c d / e").Tokens()
+	tree, err := ir.parse(tokens)
+	ass.NoError(err)
+	ass.Equal("a + 1 / 2 b to c d / e", tree.String())
+	postfix := []string{}
+	for _, tok := range tree.Postfix() {
+		postfix = append(postfix, tok.String())
+	}
+	ass.Equal("a 1 2 b * / + c d * e / to", strings.Join(postfix, " "))
+	ass.Equal("c d/e", tree.Postfix()[len(postfix)-1].Literal)
+
+	// to and in are variables in other modes
+	ir = NewInterpreter(false, 2)
+	ir.SetImplicitMul(true)
+	for _, instr := range []string{"in = 3", "to = 4", "x = 2"} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+	ass.Equal("6.00", ir.ProcessInstruction("2in"))
+	ass.Equal("8.00", ir.ProcessInstruction("x to"))
+	ass.Equal("", ir.ProcessInstruction(";implicit off"))
+	ass.Equal("error: at index 2: missing operator before to\nerror: at index 5: missing operator before 2",
+		ir.ProcessInstruction("1 to 2"))
+
+	// function declared in unit mode keeps conversion
+	ass.NoError(ir.SetMode(ModeUnit, 0))
+	ass.Equal("", ir.ProcessInstruction("@f = (v, u): v to u"))
+	ass.NoError(ir.SetMode(ModeFloat, 0))
+	ass.Equal("error: at index 0: call @f: to needs unit mode", ir.ProcessInstruction("@f(1, 2)"))
+}
+
+func TestLookupUnit(t *testing.T) {
+	ass := assert.New(t)
+	tests := []struct {
+		name  string
+		scale float64
+		dim   Dimension
+	}{
+		{"m", 1, Dimension{dimLength: 1}},
+		{"km", 1e3, Dimension{dimLength: 1}},
+		{"kg", 1, Dimension{dimMass: 1}},
+		{"mg", 1e-6, Dimension{dimMass: 1}},
+		{"µs", 1e-6, Dimension{dimTime: 1}},
+		{"us", 1e-6, Dimension{dimTime: 1}},
+		{"ms", 1e-3, Dimension{dimTime: 1}},
+		{"min", 60, Dimension{dimTime: 1}},
+		{"mi", 1609.344, Dimension{dimLength: 1}},
+		{"dam", 10, Dimension{dimLength: 1}},
+		{"cd", 1, Dimension{dimLuminosity: 1}},
+		{"hPa", 100, Dimension{dimLength: -1, dimMass: 1, dimTime: -2}},
+		{"mL", 1e-6, Dimension{dimLength: 3}},
+		{"GWh", 3.6e12, Dimension{dimLength: 2, dimMass: 1, dimTime: -2}},
+		{"kmi", 0, Dimension{}},
+		{"kt", 0, Dimension{}},
+		{"xyz", 0, Dimension{}},
+		{"k", 0, Dimension{}},
+	}
+	for _, test := range tests {
+		u, ok := lookupUnit(test.name)
+		ass.Equal(test.scale != 0, ok, test.name)
+		ass.InDelta(test.scale, u.scale, test.scale*1e-15, test.name)
+		ass.Equal(test.dim, u.dim, test.name)
+	}
+
+	ass.Equal("m*kg/s^2", Dimension{dimLength: 1, dimMass: 1, dimTime: -2}.String())
+	ass.Equal("1/(s*A)", Dimension{dimTime: -1, dimCurrent: -1}.String())
+	ass.Equal("", Dimension{}.String())
+	ass.Contains(Units(), "mph")
+}
+
+func TestUnitModeConversion(t *testing.T) {
+	ass := assert.New(t)
+	ir := NewInterpreter(false, 2)
+	ass.Equal("", ir.ProcessInstruction("a = 2"))
+	ass.NoError(ir.SetMode(ModeUnit, 0))
+	for _, instr := range []string{"b = 1.5 km", "c = 3 m * 2 s", "d = 250 m / 1 km", "e := 1 / 0 m"} {
+		ass.Equal("", ir.ProcessInstruction(instr), instr)
+	}
+	ass.Equal("2.00 km", ir.ProcessInstruction("a km"))
+
+	buf := &strings.Builder{}
+	ass.NoError(ir.Save(buf))
+	ass.Equal(";mode unit\n"+
+		"a = 2\n"+
+		"b = 1500 * m to km\n"+
+		"c = 6 * m*s\n"+
+		"d = 0.25\n"+
+		"e := 1 / 0 * 1/m\n", buf.String())
+	loaded := NewInterpreter(false, 2)
+	report, err := loaded.Load(strings.NewReader(buf.String()))
+	ass.NoError(err)
+	ass.Empty(report.Errors)
+	ass.Equal(ir.Vars(), loaded.Vars())
+	ass.Equal("1.50 km", loaded.ProcessInstruction("b"))
+	ass.True(math.IsInf(loaded.vars["e"].(Quantity).Num, 1))
+
+	// quantities with units stay in unit mode
+	ass.Equal("", ir.ProcessInstruction(";del c e"))
+	ass.EqualError(ir.SetMode(ModeFloat, 0), "b: value has unit km")
+	ass.Equal("", ir.ProcessInstruction(";del b"))
+	ass.NoError(ir.SetMode(ModeRat, 0))
+	ass.Equal("1/4", ir.ProcessInstruction("d"))
+	ass.Equal("error: at index 2: missing operator before km", ir.ProcessInstruction("a km"))
+}